@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// patEnv is the environment variable that overrides every other source of the personal access token
+const patEnv = "MIGR8_PAT"
+
+// keyringService is the service attribute of the tokens that migr8 stores in the Secret Service keyring
+const keyringService = "migr8"
+
+var (
+	authDevOpsOrg string
+	authCmd       = &cobra.Command{
+		Use:   "auth",
+		Short: "Store and check the Azure DevOPS personal access token",
+		Long: "Store and check the Azure DevOPS personal access token. The token is looked up in this order: the " + patEnv +
+			" environment variable, the pat of the config (a plain token or env:NAME), the file in patFile and finally the Secret Service keyring",
+		PersistentPreRun: authPrerun,
+		Version:          rootCmd.Version,
+	}
+	authSetCmd = &cobra.Command{
+		Use:   "set",
+		Short: "Store a personal access token in the Secret Service keyring",
+		Long:  "Store a personal access token in the Secret Service keyring. The token is read from stdin, or prompted for without echo in a terminal",
+		Run:   authSetRun,
+	}
+	authCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Check that the personal access token is accepted by Azure DevOPS",
+		Long:  "Resolve the personal access token like every other command does and check that Azure DevOPS accepts it",
+		Run:   authCheckRun,
+	}
+)
+
+func init() {
+	authCmd.PersistentFlags().StringVarP(&infraConfigPath, "infraConfig", "i", "", "An infrastructure configuration to take the devops organization and the token sources from")
+	authCmd.PersistentFlags().StringVar(&authDevOpsOrg, "devopsOrg", "", "The azure devops organization url, e.g. https://dev.azure.com/<organization-name>")
+
+	authCmd.AddCommand(authSetCmd)
+	authCmd.AddCommand(authCheckCmd)
+
+	rootCmd.AddCommand(authCmd)
+}
+
+func authPrerun(cmd *cobra.Command, args []string) {
+	if infraConfigPath != "" {
+		readInfraConfig()
+	}
+	if authDevOpsOrg != "" {
+		infraConfig.DevOpsOrg = authDevOpsOrg
+	}
+	if strings.TrimSpace(infraConfig.DevOpsOrg) == "" {
+		logger.Error("no azure devops organization", "phase", "auth", "hint", "use --devopsOrg or -i")
+		os.Exit(exitConfig)
+	}
+}
+
+func authSetRun(cmd *cobra.Command, args []string) {
+	token, readErr := readToken()
+	if readErr != nil {
+		logger.Error("failed to read the token", "phase", "auth", "error", readErr)
+		os.Exit(exitAuth)
+	}
+
+	storeErr := storeKeyringPat(infraConfig.DevOpsOrg, token)
+	if storeErr != nil {
+		logger.Error("failed to store the token in the keyring", "phase", "auth", "error", storeErr)
+		os.Exit(exitAuth)
+	}
+	logger.Info("token stored in the keyring", "phase", "auth", "organization", infraConfig.DevOpsOrg)
+
+	user, checkErr := checkPat(infraConfig.DevOpsOrg, token)
+	if checkErr != nil {
+		logger.Warn("the stored token was not accepted", "phase", "auth", "error", checkErr)
+		os.Exit(exitAuth)
+	}
+	logger.Info("the token is valid", "phase", "auth", "user", user)
+}
+
+func authCheckRun(cmd *cobra.Command, args []string) {
+	token, source, patErr := resolvePat(infraConfig, filepath.Dir(infraConfigPath))
+	if patErr != nil {
+		logger.Error("failed to resolve the personal access token", "phase", "auth", "error", patErr)
+		os.Exit(exitAuth)
+	}
+
+	user, checkErr := checkPat(infraConfig.DevOpsOrg, token)
+	if checkErr != nil {
+		logger.Error("the token was not accepted", "phase", "auth", "source", source, "error", checkErr)
+		os.Exit(exitAuth)
+	}
+	logger.Info("the token is valid", "phase", "auth", "source", source, "organization", infraConfig.DevOpsOrg, "user", user)
+}
+
+// resolvePat returns the personal access token of a config and where it was found. A relative patFile is
+// resolved against baseDir
+func resolvePat(config migr8.InfraConfig, baseDir string) (string, string, error) {
+	if token := strings.TrimSpace(os.Getenv(patEnv)); token != "" {
+		return token, "environment variable " + patEnv, nil
+	}
+
+	if name, isReference := strings.CutPrefix(config.Pat, "env:"); isReference {
+		token := strings.TrimSpace(os.Getenv(name))
+		if token == "" {
+			return "", "", fmt.Errorf("environment variable %s referenced by pat is not set", name)
+		}
+		return token, "environment variable " + name, nil
+	}
+
+	if token := strings.TrimSpace(config.Pat); token != "" {
+		return token, "config file", nil
+	}
+
+	if config.PatFile != "" {
+		patFile := config.PatFile
+		if !filepath.IsAbs(patFile) {
+			patFile = filepath.Join(baseDir, patFile)
+		}
+		content, readErr := os.ReadFile(patFile)
+		if readErr != nil {
+			return "", "", fmt.Errorf("failed to read patFile => %s", readErr.Error())
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return "", "", fmt.Errorf("patFile %s is empty", patFile)
+		}
+		return token, "file " + patFile, nil
+	}
+
+	token, keyringErr := keyringPat(config.DevOpsOrg)
+	if keyringErr != nil {
+		return "", "", fmt.Errorf("no personal access token found. Set %s, pat or patFile or store one with 'migr8 auth set' => %s", patEnv, keyringErr.Error())
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("no personal access token found. Set %s, pat or patFile or store one with 'migr8 auth set'", patEnv)
+	}
+	return token, "keyring", nil
+}
+
+// keyringPat looks up the token of a devops organization in the Secret Service keyring with secret-tool
+func keyringPat(devopsOrg string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "organization", keyringOrg(devopsOrg)).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// secret-tool exits with 1 and prints nothing when there is no matching secret
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("secret-tool => %w", migr8.CommandError(err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// storeKeyringPat stores the token of a devops organization in the Secret Service keyring with secret-tool
+func storeKeyringPat(devopsOrg string, token string) error {
+	store := exec.Command("secret-tool", "store", "--label", "migr8 personal access token for "+keyringOrg(devopsOrg),
+		"service", keyringService, "organization", keyringOrg(devopsOrg))
+	store.Stdin = strings.NewReader(token)
+	_, err := store.Output()
+	return migr8.CommandError(err)
+}
+
+func keyringOrg(devopsOrg string) string {
+	return strings.TrimSuffix(strings.TrimSpace(devopsOrg), "/")
+}
+
+// readToken reads a token from stdin. A terminal gets a prompt and the token isn't echoed
+func readToken() (string, error) {
+	var token string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Personal access token: ")
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		token = string(secret)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		token = line
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("the token is empty")
+	}
+	return token, nil
+}
+
+// checkPat calls the devops api with the token and returns the name of the user it belongs to
+func checkPat(devopsOrg string, token string) (string, error) {
+	request, err := http.NewRequest(http.MethodGet, keyringOrg(devopsOrg)+"/_apis/connectionData", nil)
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth("", token)
+	request.Header.Set("Accept", "application/json")
+
+	client := http.Client{Timeout: 30 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	// devops answers an invalid token with a sign in page instead of an error status
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		return "", fmt.Errorf("azure devops responded with %s", response.Status)
+	}
+
+	var connection struct {
+		AuthenticatedUser struct {
+			ProviderDisplayName string `json:"providerDisplayName"`
+		} `json:"authenticatedUser"`
+	}
+	decodeErr := json.NewDecoder(response.Body).Decode(&connection)
+	if decodeErr != nil {
+		return "", decodeErr
+	}
+	return connection.AuthenticatedUser.ProviderDisplayName, nil
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// consoleHandler ~ a slog handler that writes every record as a colored line in the
+// [LEVEL:] => [PHASE app] => MESSAGE: RESOURCE name key=value => error form of the cli
+type consoleHandler struct {
+	mu      *sync.Mutex
+	out     io.Writer
+	level   slog.Leveler
+	noColor bool
+	attrs   []slog.Attr
+	group   string
+}
+
+// newConsoleHandler creates a consoleHandler. Colors are left out when noColor is set, e.g. for a log file
+func newConsoleHandler(out io.Writer, level slog.Leveler, noColor bool) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, out: out, level: level, noColor: noColor}
+}
+
+func (handler *consoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= handler.level.Level()
+}
+
+func (handler *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	copied := *handler
+	copied.attrs = append(append([]slog.Attr{}, handler.attrs...), handler.qualify(attrs)...)
+	return &copied
+}
+
+func (handler *consoleHandler) WithGroup(name string) slog.Handler {
+	copied := *handler
+	copied.group = handler.qualifyKey(name)
+	return &copied
+}
+
+func (handler *consoleHandler) Handle(ctx context.Context, record slog.Record) error {
+	var phase, app, resource, name, action, result string
+	var err any
+	fields := []string{}
+
+	attrs := append([]slog.Attr{}, handler.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, handler.qualify([]slog.Attr{attr})...)
+		return true
+	})
+	for _, attr := range attrs {
+		value := attr.Value.Resolve()
+		switch attr.Key {
+		case "phase":
+			phase = value.String()
+		case "app":
+			app = value.String()
+		case "resource":
+			resource = value.String()
+		case "name":
+			name = value.String()
+		case "error":
+			err = value.Any()
+		case "action":
+			// the action only picks the color, the message already tells what happened
+			action = value.String()
+		case "result":
+			result = value.String()
+			fields = append(fields, attr.Key+"="+formatValue(value))
+		default:
+			fields = append(fields, attr.Key+"="+formatValue(value))
+		}
+	}
+
+	parts := []string{}
+	if scope := strings.TrimSpace(strings.ToUpper(phase) + " " + app); scope != "" {
+		parts = append(parts, "["+scope+"]")
+	}
+	message := strings.ToUpper(record.Message)
+	if name != "" {
+		message = strings.TrimSpace(fmt.Sprintf("%s: %s %s", message, strings.ToUpper(resource), name))
+	}
+	parts = append(parts, strings.Join(append([]string{message}, fields...), " "))
+	if err != nil {
+		parts = append(parts, fmt.Sprint(err))
+	}
+
+	line := ""
+	lineColor := color.New(color.FgCyan)
+	switch {
+	case record.Level >= slog.LevelError:
+		line = "[ERR:] => " + strings.Join(parts, " => ")
+		lineColor = color.New(color.FgRed)
+	case record.Level >= slog.LevelWarn:
+		line = "[WARN:] => " + strings.Join(parts, " => ")
+		lineColor = color.New(color.FgYellow)
+	case record.Level >= slog.LevelInfo:
+		line = "[INFO:] " + strings.Join(parts, " ")
+		if action == "created" || action == "deleted" || action == "swapped" || result == "succeeded" {
+			lineColor = color.New(color.FgGreen)
+		}
+	default:
+		line = "[DEBUG:] " + strings.Join(parts, " ")
+		lineColor = color.New(color.FgWhite)
+	}
+	if handler.noColor {
+		lineColor.DisableColor()
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	_, writeErr := lineColor.Fprintln(handler.out, line)
+	return writeErr
+}
+
+// qualify prefixes the keys of attrs with the group of the handler
+func (handler *consoleHandler) qualify(attrs []slog.Attr) []slog.Attr {
+	qualified := []slog.Attr{}
+	for _, attr := range attrs {
+		if attr.Value.Kind() == slog.KindGroup {
+			group := handler.qualifyKey(attr.Key)
+			for _, member := range attr.Value.Group() {
+				qualified = append(qualified, slog.Attr{Key: group + "." + member.Key, Value: member.Value})
+			}
+			continue
+		}
+		qualified = append(qualified, slog.Attr{Key: handler.qualifyKey(attr.Key), Value: attr.Value})
+	}
+	return qualified
+}
+
+func (handler *consoleHandler) qualifyKey(key string) string {
+	if handler.group == "" {
+		return key
+	}
+	return handler.group + "." + key
+}
+
+// formatValue quotes the values that contain spaces, so that every field stays a single key=value
+func formatValue(value slog.Value) string {
+	text := value.String()
+	if value.Kind() == slog.KindDuration {
+		text = value.Duration().Round(time.Millisecond).String()
+	}
+	if text == "" || strings.ContainsAny(text, " \t\"=") {
+		return strconv.Quote(text)
+	}
+	return text
+}
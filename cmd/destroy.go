@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/fatih/color"
+	prettyTable "github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	destroyYes   bool
+	destroyForce bool
+	destroyCmd   = &cobra.Command{
+		Use:   "destroy",
+		Short: "Delete all the infrastructure and pipelines described by an application stack",
+		Long: "Delete all the infrastructure and pipelines described by an application stack. Resources are deleted in reverse " +
+			"dependency order: pipelines, apps, app service plans and storage accounts, resource groups. Shared resources that " +
+			"are still used by apps outside the configuration are kept, and so are the resources that existed before migr8 " +
+			"unless --force is set",
+		PersistentPreRun: destroyPrerun,
+		Run:              destroyRun,
+		Version:          rootCmd.Version,
+	}
+)
+
+func init() {
+	destroyCmd.Flags().BoolVarP(&destroyYes, "yes", "y", false, "Skip the confirmation prompt")
+	destroyCmd.Flags().BoolVar(&destroyForce, "force", false, "Also delete the resources that the state file records as existing before migr8")
+
+	infraCmd.AddCommand(destroyCmd)
+}
+
+func destroyPrerun(cmd *cobra.Command, args []string) {
+	loadConfig()
+	// nothing is queued during a destroy, so there is no need to select a subscription
+	azureLogin()
+}
+
+func destroyRun(cmd *cobra.Command, args []string) {
+	infraRunner.Options.ConfirmDestroy = confirmDestroy
+	infraRunner.Options.ForceDestroy = destroyForce
+
+	results, destroyErr := infraRunner.Destroy(cmd.Context())
+	if errors.Is(destroyErr, migr8.ErrAborted) {
+		logger.Warn("destroy aborted. Nothing was deleted", "phase", migr8.PhaseDestroy)
+		return
+	}
+
+	printDestroyResults(results)
+
+	// resources that weren't found weren't worked on
+	failed, total := 0, 0
+	for _, result := range results {
+		if result.Status == "FAILED" {
+			failed++
+		}
+		if result.Status != "NOT FOUND" {
+			total++
+		}
+	}
+	os.Exit(failureExitCode(failed, total))
+}
+
+// confirmDestroy lists the resources that destroy found and asks before any of them is deleted
+func confirmDestroy(pending []migr8.DestroyResult) bool {
+	color.Yellow("\nTHE FOLLOWING RESOURCES WILL BE DELETED UNLESS THEY ARE STILL IN USE:")
+	for _, target := range pending {
+		history := target.Note
+		if history != "" {
+			history = " (" + history + ")"
+		}
+		color.Yellow("  - %s %s%s", target.Resource, target.Name, history)
+	}
+
+	return destroyYes || Confirm(fmt.Sprintf("Delete %d resources?", len(pending)))
+}
+
+func printDestroyResults(results []migr8.DestroyResult) {
+	t := prettyTable.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+
+	color.Cyan("\n############### MIGR8 DESTROY RESULTS ##############\n")
+
+	t.AppendHeader(prettyTable.Row{"RESOURCE", "NAME", "STATUS", "NOTE"})
+	for _, result := range results {
+		t.AppendRow(prettyTable.Row{result.Resource, result.Name, result.Status, result.Note})
+	}
+
+	t.Render()
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configEnv is the environment selected with --env and configVars are the variables set with --var
+	configEnv    string
+	configVars   []string
+	renderOutput string
+	configCmd    = &cobra.Command{
+		Use:     "config",
+		Short:   "Inspect infrastructure configurations",
+		Long:    "Inspect infrastructure configurations",
+		Version: rootCmd.Version,
+	}
+	renderCmd = &cobra.Command{
+		Use:   "render",
+		Short: "Print the configuration that a run would use",
+		Long: "Print the configuration that a run would use, after the overrides of the environment were merged onto it and " +
+			"the variables were interpolated and the settingsFrom sources were merged into the settings. The personal access " +
+			"token is masked",
+		Run:     renderRun,
+		Version: rootCmd.Version,
+	}
+)
+
+func init() {
+	renderCmd.Flags().StringVarP(&infraConfigPath, "infraConfig", "i", "", "The infrastructre configuration to be rendered")
+	renderCmd.MarkFlagRequired("infraConfig")
+	renderCmd.Flags().StringVar(&configEnv, "env", "", "The environment whose overrides are merged onto the configuration")
+	renderCmd.Flags().StringArrayVar(&configVars, "var", nil, "Set a variable for the ${VAR} placeholders of the configuration, e.g. --var ENV=prod. Overrides the environment")
+	renderCmd.Flags().StringVarP(&renderOutput, "output", "o", "json", "The output format: json | yaml")
+
+	configCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func renderRun(cmd *cobra.Command, args []string) {
+	if !slices.Contains([]string{"json", "yaml"}, renderOutput) {
+		logger.Error("unknown output", "phase", "render", "output", renderOutput, "hint", "use json | yaml")
+		os.Exit(exitConfig)
+	}
+
+	readInfraConfig()
+	validationErrs := migr8.ApplyEnvironment(infraConfigPath, configEnv, &infraConfig)
+	validationErrs = append(validationErrs, migr8.InterpolateConfig(&infraConfig, configVars)...)
+	validationErrs = append(validationErrs, migr8.ResolveSettings(infraConfigPath, &infraConfig, configVars)...)
+	if len(validationErrs) > 0 {
+		printValidationErrors(validationErrs)
+		os.Exit(exitConfig)
+	}
+
+	if infraConfig.Pat != "" && !strings.HasPrefix(infraConfig.Pat, "env:") {
+		infraConfig.Pat = "***"
+	}
+
+	var out []byte
+	var marshalErr error
+	if renderOutput == "yaml" {
+		out, marshalErr = yaml.Marshal(infraConfig)
+	} else {
+		out, marshalErr = json.MarshalIndent(infraConfig, "", "  ")
+		out = append(out, '\n')
+	}
+	if marshalErr != nil {
+		logger.Error("failed to marshal the config", "phase", "render", "error", marshalErr)
+		os.Exit(exitError)
+	}
+	os.Stdout.Write(out)
+}
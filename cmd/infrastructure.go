@@ -1,42 +1,46 @@
 package cmd
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
-	"regexp"
+	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
-	"github.com/G-MAKROGLOU/containers"
-	"github.com/G-MAKROGLOU/devops/agentpool"
-	"github.com/G-MAKROGLOU/infrastructure/azappservice"
-	"github.com/G-MAKROGLOU/infrastructure/azfunction"
 	"github.com/G-MAKROGLOU/infrastructure/azlogin"
-	"github.com/G-MAKROGLOU/infrastructure/azpipelines"
-	"github.com/G-MAKROGLOU/infrastructure/azresourcegroup"
-	"github.com/G-MAKROGLOU/infrastructure/azstorageaccount"
-	"github.com/G-MAKROGLOU/infrastructure/azwebapp"
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
 	"github.com/fatih/color"
 	prettyTable "github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 )
 
 var (
-	agentsRes    = []ChannelRes{}
-	infraRes     = []ChannelRes{}
-	pipelinesRes = []ChannelRes{}
-	queuesRes    = []ChannelRes{}
-	infraCmd     = &cobra.Command{
-		Use:               "infra",
-		Short:             "Create all the infrastructure needed by an application stack",
-		Long:              "Create all the infrastructure needed by an application stack",
-		PersistentPreRun:  prerun,
-		PersistentPostRun: cleanup,
-		Version:           rootCmd.Version,
+	// the flags of a run
+	onlyApps         []string
+	skipApps         []string
+	selectors        []string
+	parallelism      int
+	agentParallelism int
+	infraParallelism int
+	queueParallelism int
+	infraTimeout     time.Duration
+	pipelineTimeout  time.Duration
+	pollInterval     time.Duration
+	resumeRun        bool
+	failFast         bool
+
+	// infraRunner works on the loaded config. It is built by loadConfig
+	infraRunner *migr8.Runner
+
+	infraCmd = &cobra.Command{
+		Use:              "infra",
+		Short:            "Create all the infrastructure needed by an application stack",
+		Long:             "Create all the infrastructure needed by an application stack",
+		PersistentPreRun: prerun,
+		Version:          rootCmd.Version,
 	}
 	onlyInfraCmd = &cobra.Command{
 		Use:     "create",
@@ -59,587 +63,291 @@ var (
 		Run:     run,
 		Version: rootCmd.Version,
 	}
+	swapCmd = &cobra.Command{
+		Use:     "swap",
+		Short:   "Swap the deploy slot of every app into production once it is healthy",
+		Long:    "Swap the deploy slot of every app into production once its health check passes. Swapping again swaps the previous production back",
+		Run:     run,
+		Version: rootCmd.Version,
+	}
 )
 
 // opeational
 func init() {
 	infraCmd.PersistentFlags().StringVarP(&infraConfigPath, "infraConfig", "i", "", "The infrastructre configuration to be deployed")
 	infraCmd.MarkFlagRequired("infraConfig")
+	infraCmd.PersistentFlags().StringVar(&configEnv, "env", "", "The environment whose overrides are merged onto the configuration, e.g. --env staging")
+	infraCmd.PersistentFlags().StringSliceVar(&onlyApps, "only", nil, "Only work on the given apps, e.g. --only api,web")
+	infraCmd.PersistentFlags().StringSliceVar(&skipApps, "skip", nil, "Leave out the given apps, e.g. --skip legacy")
+	infraCmd.PersistentFlags().StringSliceVar(&selectors, "selector", nil, "Only work on the apps whose labels match every selector, e.g. --selector tier=frontend,region!=us")
+	infraCmd.PersistentFlags().StringArrayVar(&configVars, "var", nil, "Set a variable for the ${VAR} placeholders of the configuration, e.g. --var ENV=prod. Overrides the environment")
+
+	for _, runCmd := range []*cobra.Command{onlyInfraCmd, onlyDeployCmd, fullCmd, swapCmd} {
+		runCmd.Flags().IntVar(&parallelism, "parallelism", 0, "The maximum number of apps that every phase works on at the same time. 0 means no limit")
+		runCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Stop the remaining work as soon as one app fails. Running pipeline runs are cancelled")
+	}
+	for _, deployCmd := range []*cobra.Command{onlyDeployCmd, fullCmd} {
+		deployCmd.Flags().BoolVar(&resumeRun, "resume", false, "Reattach to the pipeline runs of an interrupted run and skip the apps whose last run succeeded")
+		deployCmd.Flags().IntVar(&agentParallelism, "agent-parallelism", 0, "The maximum number of agents started at the same time. Defaults to --parallelism")
+		deployCmd.Flags().IntVar(&queueParallelism, "queue-parallelism", 0, "The maximum number of pipeline runs in flight at the same time. Defaults to --parallelism")
+		deployCmd.Flags().DurationVar(&pipelineTimeout, "pipeline-timeout", 0, "How long a pipeline run may take before it is cancelled, e.g. 45m. 0 means no limit")
+		deployCmd.Flags().DurationVar(&pollInterval, "poll-interval", 30*time.Second, "How often the status of a queued pipeline run is checked and the health check of a deploy slot repeated")
+	}
+	for _, createCmd := range []*cobra.Command{onlyInfraCmd, fullCmd} {
+		createCmd.Flags().IntVar(&infraParallelism, "infra-parallelism", 0, "The maximum number of apps whose infrastructure is created at the same time. Defaults to --parallelism")
+		createCmd.Flags().DurationVar(&infraTimeout, "infra-timeout", 0, "How long the infrastructure of a single app may take to create, e.g. 10m. 0 means no limit")
+	}
+	swapCmd.Flags().DurationVar(&pollInterval, "poll-interval", 30*time.Second, "How often the health check of a slot is repeated until it passes")
 
 	infraCmd.AddCommand(onlyInfraCmd)
 	infraCmd.AddCommand(onlyDeployCmd)
 	infraCmd.AddCommand(fullCmd)
+	infraCmd.AddCommand(swapCmd)
 
 	rootCmd.AddCommand(infraCmd)
 }
 
 func prerun(cmd *cobra.Command, args []string) {
-	configErr := ReadJSON(infraConfigPath, &infraConfig)
-	if configErr != nil {
-		os.Exit(1)
+	if pollInterval <= 0 {
+		logger.Error("the poll interval must be greater than 0", "phase", "config", "poll_interval", pollInterval)
+		os.Exit(exitConfig)
+	}
+	checkReportFlags()
+
+	loadConfig()
+	if cmd == swapCmd {
+		checkDeploySlots()
 	}
-	validateConfig()
 	login()
 
-	sigs := make(chan os.Signal, 1)
+	// the first signal cancels the run, so that every worker stops and cancels its pipeline run. A second signal
+	// doesn't wait for the workers anymore
+	ctx, cancel := context.WithCancel(cmd.Context())
+	cmd.SetContext(ctx)
+
+	sigs := make(chan os.Signal, 2)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigs
-		color.Yellow("RECEIVED TERMINATION SIGNAL. CLEANING UP RESOURCES...")
-		cleanup(nil, nil)
-		os.Exit(0)
-	}()
-}
-
-func run(cmd *cobra.Command, args []string) {
-	isCompleteRun := cmd.CalledAs() == "complete"
-	isDeployOnly := cmd.CalledAs() == "deploy"
-	isCreateOnly := cmd.CalledAs() == "create"
-
-	agentsChan := make(chan ChannelRes, len(infraConfig.Infrastructure))
-	infraChan := make(chan ChannelRes, len(infraConfig.Infrastructure))
-	pipelineChan := make(chan ChannelRes, len(infraConfig.Infrastructure))
-	queuesChan := make(chan ChannelRes, len(infraConfig.Infrastructure))
-
-	if isCompleteRun || isDeployOnly {
-		copyBuildContextConfig()
-		initalizeDockerClient()
-		buildAgentPoolImage()
-		startAgents(agentsChan)
-		for agent := range agentsChan {
-			agentsRes = append(agentsRes, agent)
-		}
-	}
-
-	if isCompleteRun || isCreateOnly {
-		createInfrastructure(infraChan)
-		for infra := range infraChan {
-			infraRes = append(infraRes, infra)
-		}
-	}
-
-	if isCompleteRun || isDeployOnly {
-		createPipelines(isCompleteRun, pipelineChan)
-		for pipeline := range pipelineChan {
-			pipelinesRes = append(pipelinesRes, pipeline)
-		}
+		logger.Warn("received a termination signal. Cancelling the run, press ctrl+c again to exit immediately")
+		cancel()
 
-		quequePipelines(queuesChan)
-		for queue := range queuesChan {
-			queuesRes = append(queuesRes, queue)
+		<-sigs
+		logger.Warn("received a termination signal. Cleaning up the agents")
+		cleanupErr := infraRunner.Cleanup()
+		if cleanupErr != nil {
+			logger.Error("failed to clean up the agents", "phase", migr8.PhaseAgent, "error", cleanupErr)
 		}
-	}
-}
-
-func cleanup(cmd *cobra.Command, args []string) {
-
-	isCompleteRun := cmd.CalledAs() == "complete"
-	isCreateRun := cmd.CalledAs() == "create"
-	isDeployRun := cmd.CalledAs() == "deploy"
-
-	var waitGroup sync.WaitGroup
-	waitGroup.Add(1)
-
-	if isCompleteRun || isDeployRun {
-		waitGroup.Add(1)
-
-		go func() {
-			defer waitGroup.Done()
-			// stop and remove all created containers
-			for _, contID := range agentpool.ContainerIDs {
-				stopErr := containers.StopContainer(contID)
-				if stopErr != nil {
-					color.Red(stopErr.Error())
-				}
-				purgeErr := containers.PurgeContainer(contID)
-				if purgeErr != nil {
-					color.Red(purgeErr.Error())
-				}
-			}
-
-			// remove image
-			imgExists, delImgErr := containers.DeleteImage("azp_agent:latest")
-			if delImgErr != nil {
-				color.Red(delImgErr.Error())
-			}
-			if !imgExists {
-				color.Yellow("[WARN:] IMAGE DOES NOT EXIST. SKIPPING IMAGE DELETION")
-			}
-
-			// remove any possible dangling images
-			pruneReport, pruneErr := containers.PruneDanglingImages()
-			if pruneErr != nil {
-				color.Red(pruneErr.Error())
-			}
-			if pruneErr == nil {
-				color.Cyan("[INFO:] PRUNED %d DANGLING IMAGES. RECLAIMED %d SPACE", len(pruneReport.ImagesDeleted), pruneReport.SpaceReclaimed)
-			}
-		}()
-	}
-
-	go func() {
-		defer waitGroup.Done()
-		// delete img build ctx
-		delErr := os.RemoveAll("migr8_agentpool_build_ctx")
-		if delErr != nil {
-			color.Red("[ERR]: FAILED TO DELETE BUILD CONTEXT DIRECTORY")
+		if cmd.CalledAs() == migr8.ModeDeploy || cmd.CalledAs() == migr8.ModeComplete {
+			logger.Info("the queued pipeline runs are recorded in the state file", "state", infraRunner.Options.StatePath, "hint", "rerun with --resume to reattach to them")
 		}
+		os.Exit(exitInterrupted)
 	}()
-
-	waitGroup.Wait()
-
-	if cmd != nil {
-		// produce results table
-		printResults(isCompleteRun, isCreateRun, isDeployRun)
-	}
 }
 
-// core run functions
-func validateConfig() {
-	if strings.TrimSpace(infraConfig.Pat) == "" {
-		color.Yellow("[WARN:] NO PERSONAL ACCESS TOKEN FOUND. SKIPPING ANY RESOURCE ALLOCATIONS")
-		os.Exit(1)
-	}
-	if strings.TrimSpace(infraConfig.DevOpsOrg) == "" {
-		color.Yellow("[WARN:] NO AZURE DEVOPS ORGANIZATION URL FOUND. SKIPPING ANY RESOURCE ALLOCATIONS")
-		os.Exit(1)
-	}
-	if len(infraConfig.Infrastructure) == 0 || infraConfig.Infrastructure == nil {
-		color.Yellow("[WARN:] NO INFRASTRUCTURE DESCRIPTION FOUND. SKIPPING ANY RESOURCE ALLOCATIONS")
-		os.Exit(1)
-	}
-}
-
-func login() {
-	loginErr := azlogin.AzureLogin()
-	if loginErr != nil {
-		color.Red("[ERR:] => AZ LOGIN => %s", loginErr.Error())
-		os.Exit(1)
-	}
-	azlogin.SelectSubscription()
-}
-
-func copyBuildContextConfig() {
-	ctxPath := "migr8_agentpool_build_ctx"
-
-	stat, _ := os.Stat(ctxPath)
-	if stat == nil {
-		if err := agentpool.CreateBuildCtx(ctxPath); err != nil {
-			color.Red(err.Error())
-			os.Exit(1)
-
-		}
-	}
-}
-
-func initalizeDockerClient() {
-	color.Cyan("[INFO:] INITIALIZING DOCKER CLIENT")
-	initDockerClientErr := containers.InitializeDockerClient()
-	if initDockerClientErr != nil {
-		color.Red(initDockerClientErr.Error())
-		os.Exit(1)
-	}
-}
-
-func buildAgentPoolImage() {
-	dir, homeDirErr := os.Getwd()
-	if homeDirErr != nil {
-		color.Red("[ERR:] => HOME DIR => %s", homeDirErr.Error())
-		os.Exit(1)
+func run(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	runs := map[string]func(context.Context) (*migr8.Run, error){
+		migr8.ModeCreate:   infraRunner.Create,
+		migr8.ModeDeploy:   infraRunner.Deploy,
+		migr8.ModeComplete: infraRunner.Complete,
+		migr8.ModeSwap:     infraRunner.Swap,
 	}
 
-	color.Cyan("[INFO:] BUILDING AGENT POOL IMAGE")
-
-	buildErr := containers.BuildImage(dir+"\\migr8_agentpool_build_ctx", "azp_agent")
-	if buildErr != nil {
-		color.Red("[ERR:] => IMAGE BUILD => %s", buildErr.Error())
-		os.Exit(1)
+	infraRun, runErr := runs[cmd.CalledAs()](ctx)
+	if runErr != nil {
+		logger.Error("the run failed", "error", runErr)
+		os.Exit(exitError)
 	}
 
-	color.Cyan("[INFO:] AGENT POOL IMAGE BUILT SUCCESSFULLY")
-}
-
-func startAgents(agentsChan chan<- ChannelRes) {
-	color.Cyan("[INFO:] STARTING ALL AGENTS")
-
-	var waitGroup sync.WaitGroup
-	for _, appDetails := range infraConfig.Infrastructure {
-		waitGroup.Add(1)
-		go agentWorker(appDetails, &waitGroup, agentsChan)
+	// produce results table, unless the report takes its place on stdout
+	if reportFormat == "" || reportFile != "" {
+		printResults(infraRun)
 	}
-	waitGroup.Wait()
-	close(agentsChan)
-}
+	writeReport(infraRun)
 
-func createInfrastructure(infraChan chan<- ChannelRes) {
-	color.Cyan("[INFO:] CREATING ALL INFRASTRUCTURE")
-
-	var waitGroup sync.WaitGroup
-	for _, appDetails := range infraConfig.Infrastructure {
-		waitGroup.Add(1)
-		go infraWorker(appDetails, &waitGroup, infraChan)
+	if ctx.Err() != nil {
+		logger.Warn("the run was interrupted before all phases finished")
 	}
-	waitGroup.Wait()
-	close(infraChan)
-}
-
-func createPipelines(isCompleteRun bool, pipelineChan chan<- ChannelRes) {
-	color.Cyan("[INFO:] CREATING ALL PIPELINES")
-
-	var waitGroup sync.WaitGroup
-
-	for _, appDetails := range infraConfig.Infrastructure {
-		waitGroup.Add(1)
-		go pipelineWorker(isCompleteRun, appDetails, &waitGroup, pipelineChan)
+	if ctx.Err() != nil && infraRun.IsDeploy() {
+		logger.Info("the interrupted pipeline runs can be resumed", "hint", "rerun with --resume to skip the apps whose pipeline run already succeeded")
 	}
-	waitGroup.Wait()
-	close(pipelineChan)
-}
-
-func quequePipelines(queuesChan chan<- ChannelRes) {
-	color.Cyan("[INFO:] QUEUEING ALL PIPELINES")
-
-	var waitGroup sync.WaitGroup
 
-	for _, appDetails := range infraConfig.Infrastructure {
-		waitGroup.Add(1)
-		go queuePipelineWorker(appDetails, &waitGroup, queuesChan)
-	}
-	waitGroup.Wait()
-	close(queuesChan)
+	os.Exit(runExitCode(ctx, infraRun))
 }
 
-// workers
-func agentWorker(appDetails AppDetails, waitGroup *sync.WaitGroup, agentsChan chan<- ChannelRes) {
-	defer waitGroup.Done()
-
-	containerName := appDetails.Name + "_deployment_agent"
-	configDetails := agentpool.ConfigDetails{
-		Org:           infraConfig.DevOpsOrg,
-		Pat:           infraConfig.Pat,
-		Pool:          infraConfig.AgentPool,
-		ContainerName: containerName,
-	}
-
-	channelRes := ChannelRes{
-		Key:   appDetails.Name,
-		Value: true,
-	}
-	_, agentPoolErr := agentpool.StartAgentPool(configDetails)
-	if agentPoolErr != nil {
-		color.Red("[ERR:] => WEBAPPS => %s", agentPoolErr.Error())
-		channelRes.Value = false
+// runExitCode tells CI how a run ended. An interruption wins over failures, since it left some apps undone. Apps
+// that were skipped as a whole, e.g. by --resume, don't count
+func runExitCode(ctx context.Context, infraRun *migr8.Run) int {
+	if ctx.Err() != nil {
+		return exitInterrupted
 	}
-	agentsChan <- channelRes
+	report := infraRun.Report()
+	return failureExitCode(report.Failed, report.Failed+report.Succeeded)
 }
 
-func infraWorker(appDetails AppDetails, waitGroup *sync.WaitGroup, infraChan chan<- ChannelRes) {
-	defer waitGroup.Done()
-	channelRes := ChannelRes{
-		Key:   appDetails.Name,
-		Value: true,
-	}
-
-	if appDetails.Type == "function" {
-		err := createFuncApp(appDetails)
-		if err != nil {
-			color.Red(err.Error())
-			channelRes.Value = false
-		}
-	}
-
-	if appDetails.Type == "webapp" {
-		err := createWebapp(appDetails)
-		if err != nil {
-			color.Red(err.Error())
-			channelRes.Value = false
+// core run functions
+func loadConfig() {
+	readInfraConfig()
+	validationErrs := migr8.ApplyEnvironment(infraConfigPath, configEnv, &infraConfig)
+	validationErrs = append(validationErrs, migr8.InterpolateConfig(&infraConfig, configVars)...)
+	validateConfig(append(validationErrs, migr8.ResolveSettings(infraConfigPath, &infraConfig, configVars)...))
+
+	pat, _, patErr := resolvePat(infraConfig, filepath.Dir(infraConfigPath))
+	if patErr != nil {
+		logger.Error("failed to resolve the personal access token", "phase", "pat", "error", patErr)
+		os.Exit(exitAuth)
+	}
+	infraConfig.Pat = pat
+
+	// every phase, the plan, destroy and the results only see the selected apps
+	selectedApps, selectErr := migr8.SelectApps(infraConfig.Infrastructure, onlyApps, skipApps, selectors)
+	if selectErr != nil {
+		logger.Error("failed to select the apps", "phase", "select", "error", selectErr)
+		os.Exit(exitConfig)
+	}
+	if len(selectedApps) < len(infraConfig.Infrastructure) {
+		names := []string{}
+		for _, app := range selectedApps {
+			names = append(names, app.Name)
 		}
-	}
-	infraChan <- channelRes
+		logger.Info(fmt.Sprintf("selected %d of %d apps", len(selectedApps), len(infraConfig.Infrastructure)), "phase", "select", "apps", strings.Join(names, ","))
+	}
+	infraConfig.Infrastructure = selectedApps
+
+	runner, runnerErr := migr8.NewRunner(infraConfig, migr8.Options{
+		Parallelism:      parallelism,
+		AgentParallelism: agentParallelism,
+		InfraParallelism: infraParallelism,
+		QueueParallelism: queueParallelism,
+		InfraTimeout:     infraTimeout,
+		PipelineTimeout:  pipelineTimeout,
+		PollInterval:     pollInterval,
+		Resume:           resumeRun,
+		FailFast:         failFast,
+		StatePath:        migr8.StatePath(infraConfigPath, configEnv),
+	})
+	if runnerErr != nil {
+		logger.Error("failed to read the state file", "phase", migr8.PhaseState, "error", runnerErr)
+		os.Exit(exitError)
+	}
+	runner.Subscribe(migr8.NewLogObserver(logger))
+	infraRunner = runner
 }
 
-func pipelineWorker(isCompleteRun bool, appDetails AppDetails, waitGroup *sync.WaitGroup, pipelineChan chan<- ChannelRes) {
-	defer waitGroup.Done()
-	channelRes := ChannelRes{
-		Key:   appDetails.Name,
-		Value: true,
-	}
-
-	isInfraCreated := isResourceCreated(infraRes, appDetails.Name)
-
-	if isCompleteRun && !isInfraCreated {
-		color.Yellow("[PIPELINE %s:] [WARN:] THE INFRASTRUCTURE WAS NOT CREATED. SKIPPING PIPELINE CREATION FOR UNKNOWN INFRASTRUCTURE", appDetails.Pipeline.Name)
-		channelRes.Value = false
-	}
-
-	if (isCompleteRun && isInfraCreated) || !isCompleteRun {
-		pipelineDetails := NewPipelineCreate(appDetails, infraConfig.DevOpsOrg)
-
-		err := azpipelines.CreatePipelineFromYaml(*pipelineDetails)
-		if err != nil {
-			color.Red("[PIPELINE %s:] [ERR:] => [AZ PIPELINES] => FAILED TO CREATE PIPELINE FOR APP %s OF TYPE %s => %s", appDetails.Name, appDetails.Type, err.Error())
-			channelRes.Value = false
+// checkDeploySlots exits unless a selected app has a slot to swap
+func checkDeploySlots() {
+	for _, app := range infraConfig.Infrastructure {
+		if app.DeploySlot() != nil {
+			return
 		}
 	}
-
-	pipelineChan <- channelRes
+	logger.Error("none of the selected apps has a deploy slot", "phase", migr8.PhaseSwap, "hint", "set deploy: true on a slot of the app")
+	os.Exit(exitConfig)
 }
 
-func queuePipelineWorker(appDetails AppDetails, waitGroup *sync.WaitGroup, queuesChan chan<- ChannelRes) {
-	defer waitGroup.Done()
-
-	channelRes := ChannelRes{
-		Key:   appDetails.Name,
-		Value: true,
-	}
-
-	isAgentUp := isResourceCreated(agentsRes, appDetails.Name)
-	isPipelineUp := isResourceCreated(pipelinesRes, appDetails.Name)
-	areAgentAndPipelineUp := isAgentUp && isPipelineUp
-
-	if !areAgentAndPipelineUp {
-		if !isAgentUp {
-			color.Yellow("[WARN:] => [PIPELINE %s] => THE AGENT WAS NOT CREATED. SKIPPING PIPELINE QUEUEING FOR OFFLINE AGENT", appDetails.Pipeline.Name)
-		}
-		if !isPipelineUp {
-			color.Yellow("[WARN:] => [PIPELINE %s] => THE PIPELINE WAS NOT CREATED. SKIPPING PIPELINE QUEUEING FOR UNKNOWN PIPELINE", appDetails.Pipeline.Name)
-		}
-		channelRes.Value = false
-	}
-
-	if areAgentAndPipelineUp {
-		parameters := getPipelineParams(appDetails)
-
-		pipelineDetails := NewPipelineCreate(appDetails, infraConfig.DevOpsOrg)
-
-		pipelineQueueRes, err := azpipelines.QueuePipeline(*pipelineDetails, parameters)
-		if err != nil {
-			color.Red("[ERR:]=> [AZ PIPELINES %s] => FAILED TO RUN PIPELINE => %s", appDetails.Pipeline.Name, err.Error())
-			channelRes.Value = false
-		}
-
-		// start pipeline polling only if there was no error queueing the pipeline
-		var pipelineStatus azpipelines.PipelineStatus
-		if channelRes.Value {
-			color.Cyan("[PIPELINE %s] STARTING PIPELINE STATUS POLLING", appDetails.Pipeline.Name)
-
-			for {
-				pipeline, err := azpipelines.GetPipelineStatus(infraConfig.DevOpsOrg, appDetails.Pipeline.Project, pipelineQueueRes.ID)
-				if err == nil && pipeline.Status == "completed" {
-					pipelineStatus = pipeline
-					break
-				}
-				if err == nil && pipeline.Status != "completed" {
-					color.Yellow("[PIPELINE %s:] [STATUS: %s] WAITING FOR PIPELINE TO FINISH.", appDetails.Pipeline.Name, pipeline.Status)
-				}
-				if err != nil {
-					color.Red(err.Error())
-					channelRes.Value = false
-					break
-				}
-				time.Sleep(30 * time.Second)
-			}
-		}
-
-		// if its still true, it means the pipeline completed, check status for proper logging
-		if channelRes.Value {
-			if pipelineStatus.Result == "failed" {
-				color.Red("[ERR:] => [PIPELINE %s] COMPLETED WITY STATUS %s. CHECK THE DEVOPS PORTAL FOR THE ERRORS AND RERUN WITH 'migr8 infra deploy'", appDetails.Pipeline.Name, pipelineStatus.Result)
-			}
-			if pipelineStatus.Result == "succeeded" {
-				color.Green("[PIPELINE %s:] COMPLETED WITH STATUS %s.", appDetails.Pipeline.Name, pipelineStatus.Result)
-			}
-		}
+// readInfraConfig reads the config file into infraConfig and exits if it can't be read
+func readInfraConfig() {
+	configErr := migr8.ReadConfig(infraConfigPath, &infraConfig)
+	if configErr != nil {
+		logger.Error("failed to read the config", "phase", "config", "error", configErr)
+		os.Exit(exitConfig)
 	}
-	queuesChan <- channelRes
 }
 
-// infrastructure wrappers
-func createFuncApp(funcApp AppDetails) error {
-
-	color.Cyan("[FUNCAPP %s:] CREATING AZURE FUNCTION APP", funcApp.Name)
-	errorMsg := ""
-
-	resGroupDetails := NewResourceGroupCreate(funcApp)
-
-	rgError := azresourcegroup.CreateAzureResourceGroup(*resGroupDetails)
-	if rgError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [FUNCAPP %s:] => [AZURE RESOURCE GROUP] => %s", funcApp.Name, rgError.Error())
-		return errors.New(errorMsg)
-	}
-
-	// make sure that the storage account does not exist. This is important to avoid overwriting function logs etc.
-	storageAccDetails := NewStorageAccountCreate(funcApp)
-
-	saError := azstorageaccount.CreateAzureStorageAccount(*storageAccDetails)
-	if saError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [FUNCAPP %s:] => [AZURE STORAGE ACCOUNT] => %s", funcApp.Name, saError.Error())
-		return errors.New(errorMsg)
-	}
-
-	// make sure the functionapp does not exist. This is important to avoid overwriting function during deployment
-	funcAppDetails := NewFunctionCreate(funcApp)
-
-	faError := azfunction.CreateAzureFunction(*funcAppDetails)
-	if faError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [FUNCAPP %s:] => [AZURE FUNCTIONAPP] => %s", funcApp.Name, faError.Error())
-		return errors.New(errorMsg)
-	}
-
-	// if the functionapp has not environment variables just print a message
-	if len(funcApp.Settings) == 0 {
-		color.Yellow("[WARN:] [FUNCAPP %s:] AZURE FUNCTIONAPP SETTINGS | NO SETTINGS TO UPDATE. SKIPPING SETTINGS CONFIGURATION", funcApp.Name)
-	}
-
-	// set the environment variables for the functionapp
-	if len(funcApp.Settings) != 0 {
-		faSettingsErr := azfunction.SetAzureFunctionEnv(*funcAppDetails)
-		if faSettingsErr != nil {
-			errorMsg = fmt.Sprintf("[ERR:] [FUNCAPP %s:] => [AZURE FUNCTIONAPP SETTINGS] => %s", funcApp.Name, faSettingsErr.Error())
-			return errors.New(errorMsg)
-		}
+// validateConfig exits with every error of the config, including the ones found while it was merged and interpolated
+func validateConfig(loadErrs []migr8.ValidationError) {
+	validationErrs := append(loadErrs, migr8.CheckConfig(infraConfigPath, infraConfig)...)
+	if len(validationErrs) > 0 {
+		printValidationErrors(validationErrs)
+		os.Exit(exitConfig)
 	}
-
-	return nil
 }
 
-func createWebapp(webapp AppDetails) error {
-
-	color.Cyan("[WEBAPP %s:] CREATING AZURE WEBAPP", webapp.Name)
-	errorMsg := ""
-
-	resGroupDetails := NewResourceGroupCreate(webapp)
-
-	// make sure the resource group for the webapp exists
-	rgError := azresourcegroup.CreateAzureResourceGroup(*resGroupDetails)
-	if rgError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [WEBAPP %s:] => [AZURE RESOURCE GROUP] => %s", webapp.Name, rgError.Error())
-		return errors.New(errorMsg)
-	}
-
-	aspDetails := NewAppServicePlanCreate(webapp)
-
-	// make sure the app service plan exists
-	aseError := azappservice.CreateAzureAppServicePlan(*aspDetails)
-	if aseError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [WEBAPP %s:] => [AZURE APP SERVICE PLAN] => %s", webapp.Name, aseError.Error())
-		return errors.New(errorMsg)
-	}
-
-	webappDetails := NewWebAppCreate(webapp)
-
-	// create the webapp
-	waError := azwebapp.CreateAzureWebApp(*webappDetails)
-	if waError != nil {
-		errorMsg = fmt.Sprintf("[ERR:] [WEBAPP %s:] => [AZURE WEBAPP] => %s", webapp.Name, waError.Error())
-		return errors.New(errorMsg)
-	}
-
-	return nil
+func login() {
+	azureLogin()
+	azlogin.SelectSubscription()
+	infraRunner.Options.SubscriptionID = azlogin.SelectedSubscription.ID
 }
 
-// utility functions
-func isResourceCreated(channelResults []ChannelRes, key string) bool {
-	if len(channelResults) == 0 {
-		return false
-	}
-
-	isCreated := true
-	for _, res := range channelResults {
-		if res.Key == key {
-			isCreated = res.Value
-			break
-		}
+// azureLogin logs in without selecting a subscription. It is enough for commands that never queue a pipeline
+func azureLogin() {
+	loginErr := azlogin.AzureLogin()
+	if loginErr != nil {
+		logger.Error("failed to log in to azure", "phase", "login", "error", loginErr)
+		os.Exit(exitAuth)
 	}
-	return isCreated
 }
 
-func printResults(isCompleteRun bool, isCreateRun bool, isDeployRun bool) {
+func printResults(infraRun *migr8.Run) {
 	t := prettyTable.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 
 	color.Cyan("\n############### MIGR8 RESULTS ##############\n")
 
-	t.AppendHeader(prettyTable.Row{"APP NAME", "AGENT", "INFRASTRUCTURE", "PIPELINE", "QUEUE"})
-
-	for _, app := range infraConfig.Infrastructure {
-		appName := app.Name
-		agent := "N/A"
-		infra := "N/A"
-		pipeline := "N/A"
-		queue := "N/A"
-
-		if len(agentsRes) > 0 {
-			agentCreated := isResourceCreated(agentsRes, appName)
-			if (isCompleteRun && agentCreated) || (isDeployRun && agentCreated) {
-				agent = "SUCCESS"
-			}
-			if (isCompleteRun && !agentCreated) || (isDeployRun && !agentCreated) {
-				agent = "FAILED"
-			}
-		}
-
-		if len(infraRes) > 0 {
-			infrastructureCreated := isResourceCreated(infraRes, appName)
-			if (isCompleteRun && infrastructureCreated) || (isCreateRun && infrastructureCreated) {
-				infra = "SUCCESS"
-			}
-			if (isCompleteRun && !infrastructureCreated) || (isCreateRun && !infrastructureCreated) {
-				infra = "FAILED"
+	t.AppendHeader(prettyTable.Row{"APP NAME", "PHASE", "STATUS", "DURATION", "DETAIL"})
+	t.SetColumnConfigs([]prettyTable.ColumnConfig{{Number: 1, AutoMerge: true}})
+
+	// a phase of the mode that never started, e.g. because the run was interrupted, is shown as N/A
+	phases := []struct {
+		name    string
+		results []migr8.PhaseResult
+	}{
+		{migr8.PhaseAgent, infraRun.Agents},
+		{migr8.PhaseInfrastructure, infraRun.Infrastructure},
+		{migr8.PhasePipeline, infraRun.Pipelines},
+		{migr8.PhaseQueue, infraRun.Queues},
+		{migr8.PhaseSwap, infraRun.Swaps},
+	}
+
+	counts := map[string]int{}
+	for _, app := range infraRun.Apps {
+		rows := 0
+		for _, phase := range phases {
+			if !infraRun.Applies(phase.name, app) {
+				continue
 			}
+			result := infraRun.Result(phase.results, app.Name)
+			counts[result.Status]++
+			rows++
+			t.AppendRow(prettyTable.Row{app.Name, strings.ToUpper(phase.name), describeStatus(result.Status), describeDuration(result), describeResult(result)})
 		}
-
-		if len(pipelinesRes) > 0 {
-			pipelineCreated := isResourceCreated(pipelinesRes, appName)
-			if (isCompleteRun && pipelineCreated) || (isDeployRun && pipelineCreated) {
-				pipeline = "SUCCESS"
-			}
-			if (isCompleteRun && !pipelineCreated) || (isDeployRun && !pipelineCreated) {
-				pipeline = "FAILED"
-			}
+		if rows > 0 {
+			t.AppendSeparator()
 		}
-
-		if len(queuesRes) > 0 {
-			queueCreated := isResourceCreated(queuesRes, appName)
-			if (isCompleteRun && queueCreated) || (isDeployRun && queueCreated) {
-				queue = "SUCCESS"
-			}
-			if (isCompleteRun && !queueCreated) || (isDeployRun && !queueCreated) {
-				queue = "FAILED"
-			}
-		}
-
-		t.AppendRow(prettyTable.Row{
-			appName, agent, infra, pipeline, queue,
-		})
-		t.AppendSeparator()
 	}
 
 	t.Render()
+
+	color.Cyan("RESULTS: %d SUCCEEDED, %d FAILED, %d SKIPPED, %d N/A", counts[migr8.StatusSucceeded], counts[migr8.StatusFailed], counts[migr8.StatusSkipped], counts[migr8.StatusNotApplicable])
 }
 
-func getPipelineParams(appDetails AppDetails) []string {
-	parameters := []string{
-		"azureSubscription=" + azlogin.SelectedSubscription.ID,
-		"appName=" + appDetails.Name,
-		"agentPool=" + infraConfig.AgentPool,
-		"agent=" + appDetails.Name + "_deployment_agent",
+func describeStatus(status string) string {
+	if status == migr8.StatusNotApplicable {
+		return "N/A"
 	}
+	return strings.ToUpper(status)
+}
 
-	if appDetails.Type == "function" {
-		parameters = append(parameters, "resourceGroup="+appDetails.ResourceGroup)
+func describeDuration(result migr8.PhaseResult) string {
+	if result.Status != migr8.StatusSucceeded && result.Status != migr8.StatusFailed {
+		return ""
 	}
-
-	if appDetails.Type == "webapp" {
-		for _, env := range appDetails.Settings {
-			specialChars, _ := regexp.Compile(`[!@#\$%\^&\*\(\)_\+\=\[\]\{\};'"\\|,<>?~]`)
-			param := env.Name + "=" + env.Value
-			if specialChars.MatchString(env.Value) {
-				param = fmt.Sprintf("%s=\"%s\"", env.Name, env.Value)
-			}
-			parameters = append(parameters, param)
-		}
+	if result.Duration < time.Second {
+		return result.Duration.Round(time.Millisecond).String()
 	}
+	return result.Duration.Round(time.Second).String()
+}
 
-	return parameters
+// describeResult explains a result: the error of a failure, the reason of a skip and the ids of every
+// resource that was created
+func describeResult(result migr8.PhaseResult) string {
+	lines := []string{}
+	if result.Err != nil {
+		lines = append(lines, result.Err.Error())
+	}
+	if result.Reason != "" {
+		lines = append(lines, result.Reason)
+	}
+	return strings.Join(append(lines, result.Resources...), "\n")
 }
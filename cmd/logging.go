@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// the flags of the logs
+	logLevel  string
+	logFormat string
+	logFile   string
+
+	// logger writes every diagnostic of migr8. It is replaced by setupLogging once the flags are parsed
+	logger = slog.New(newConsoleHandler(terminal{}, slog.LevelInfo, false))
+)
+
+// terminal ~ writes to color.Output at the time of the write, so that a command can still move the logs to
+// stderr after the logger was built, e.g. to keep stdout clean for a json plan
+type terminal struct{}
+
+func (terminal) Write(p []byte) (int, error) {
+	return color.Output.Write(p)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "The minimum level of the logs: debug | info | warn | error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "The format of the logs: text | json. text is the colored output of the cli")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append the logs to a file instead of writing them to the terminal")
+
+	cobra.OnInitialize(initLogging)
+}
+
+// initLogging runs before the pre run of every command, once the flags are parsed
+func initLogging() {
+	setupErr := setupLogging()
+	if setupErr != nil {
+		logger.Error("failed to set up the logs", "phase", "log", "error", setupErr)
+		os.Exit(exitConfig)
+	}
+}
+
+// setupLogging builds the logger from the log flags
+func setupLogging() error {
+	level := slog.LevelInfo
+	if levelErr := level.UnmarshalText([]byte(logLevel)); levelErr != nil {
+		return fmt.Errorf("unknown log level %s. Use debug | info | warn | error", logLevel)
+	}
+	if !slices.Contains([]string{"text", "json"}, logFormat) {
+		return fmt.Errorf("unknown log format %s. Use text | json", logFormat)
+	}
+
+	var out io.Writer = terminal{}
+	if logFile != "" {
+		file, openErr := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if openErr != nil {
+			return fmt.Errorf("failed to open the log file => %w", openErr)
+		}
+		out = file
+	}
+
+	if logFormat == "json" {
+		logger = slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level}))
+		return nil
+	}
+	logger = slog.New(newConsoleHandler(out, level, logFile != ""))
+	return nil
+}
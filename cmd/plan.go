@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/fatih/color"
+	prettyTable "github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planMode   string
+	planOutput string
+	planCmd    = &cobra.Command{
+		Use:              "plan",
+		Short:            "Show every action a run would perform without changing anything",
+		Long:             "Show every action a run would perform without changing anything. Existing resources are looked up in Azure and Azure DevOPS to decide what would be created or reused",
+		PersistentPreRun: planPrerun,
+		Run:              planRun,
+		Version:          rootCmd.Version,
+	}
+)
+
+func init() {
+	planCmd.Flags().StringVarP(&planMode, "mode", "m", "complete", "The run mode to plan for: complete | create | deploy")
+	planCmd.Flags().StringVarP(&planOutput, "output", "o", "table", "The output format of the plan: table | json")
+
+	infraCmd.AddCommand(planCmd)
+}
+
+func planPrerun(cmd *cobra.Command, args []string) {
+	if !slices.Contains([]string{migr8.ModeComplete, migr8.ModeCreate, migr8.ModeDeploy}, planMode) {
+		logger.Error("unknown mode", "phase", migr8.PhasePlan, "mode", planMode, "hint", "use complete | create | deploy")
+		os.Exit(exitConfig)
+	}
+	if !slices.Contains([]string{"table", "json"}, planOutput) {
+		logger.Error("unknown output", "phase", migr8.PhasePlan, "output", planOutput, "hint", "use table | json")
+		os.Exit(exitConfig)
+	}
+
+	// keep stdout clean for the machine-readable plan
+	if planOutput == "json" {
+		color.Output = os.Stderr
+	}
+
+	loadConfig()
+	// nothing is queued during a plan, so there is no need to select a subscription
+	azureLogin()
+}
+
+func planRun(cmd *cobra.Command, args []string) {
+	plan, planErr := infraRunner.Plan(cmd.Context(), planMode)
+	if planErr != nil {
+		logger.Error("failed to plan the run", "phase", migr8.PhasePlan, "error", planErr)
+		os.Exit(exitError)
+	}
+
+	if planOutput == "json" {
+		out, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			logger.Error("failed to marshal the plan", "phase", migr8.PhasePlan, "error", err)
+			os.Exit(exitError)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	printPlan(plan)
+}
+
+func printPlan(plan migr8.InfraPlan) {
+	t := prettyTable.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+
+	color.Cyan("\n############### MIGR8 PLAN (%s) ##############\n", plan.Mode)
+
+	t.AppendHeader(prettyTable.Row{"APP NAME", "ACTION", "RESOURCE", "NAME", "NOTE"})
+
+	counts := map[string]int{}
+	for _, app := range plan.Apps {
+		for _, action := range app.Actions {
+			counts[action.Action]++
+			t.AppendRow(prettyTable.Row{app.App, action.Action, action.Resource, action.Name, action.Note})
+		}
+		t.AppendSeparator()
+	}
+
+	t.Render()
+
+	color.Cyan("PLAN: %d TO CREATE, %d TO REUSE, %d UNKNOWN", counts["create"], counts["reuse"], counts["unknown"])
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// the flags of the report of a run
+	reportFormat string
+	reportFile   string
+
+	// reportFormats maps the extensions of --report-file to the format they imply when --report isn't set
+	reportFormats = map[string]string{".json": "json", ".xml": "junit", ".md": "markdown"}
+)
+
+type (
+	// junitTestSuites ~ the root of a junit xml report. Every run is a suite and every app a test case
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr"`
+		Cases     []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Skipped   *junitSkipped `xml:"skipped,omitempty"`
+		SystemOut *junitOutput  `xml:"system-out,omitempty"`
+	}
+
+	// the texts are cdata, so that the lines of an error aren't escaped as entities
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",cdata"`
+	}
+
+	junitOutput struct {
+		Text string `xml:",cdata"`
+	}
+
+	junitSkipped struct {
+		Message string `xml:"message,attr"`
+	}
+)
+
+func init() {
+	for _, runCmd := range []*cobra.Command{onlyInfraCmd, onlyDeployCmd, fullCmd, swapCmd} {
+		runCmd.Flags().StringVar(&reportFormat, "report", "", "Write a report of the run: json | junit | markdown. Replaces the results table on stdout unless --report-file is set")
+		runCmd.Flags().StringVar(&reportFile, "report-file", "", "Write the report to a file. The format defaults to the extension: .json, .xml or .md")
+	}
+}
+
+// checkReportFlags exits on an unknown report format. A report on stdout moves the logs to stderr
+func checkReportFlags() {
+	if reportFormat == "" && reportFile != "" {
+		reportFormat = reportFormats[strings.ToLower(filepath.Ext(reportFile))]
+		if reportFormat == "" {
+			logger.Error("unknown report format", "phase", "report", "file", reportFile, "hint", "use --report json | junit | markdown")
+			os.Exit(exitConfig)
+		}
+	}
+	if reportFormat != "" && !slices.Contains([]string{"json", "junit", "markdown"}, reportFormat) {
+		logger.Error("unknown report format", "phase", "report", "report", reportFormat, "hint", "use json | junit | markdown")
+		os.Exit(exitConfig)
+	}
+
+	// keep stdout clean for the report
+	if reportFormat != "" && reportFile == "" {
+		color.Output = os.Stderr
+	}
+}
+
+// writeReport renders the report of a run in the format of --report to --report-file or stdout
+func writeReport(infraRun *migr8.Run) {
+	if reportFormat == "" {
+		return
+	}
+
+	report := infraRun.Report()
+	var content []byte
+	var renderErr error
+	switch reportFormat {
+	case "json":
+		content, renderErr = json.MarshalIndent(report, "", "  ")
+		content = append(content, '\n')
+	case "junit":
+		content, renderErr = xml.MarshalIndent(junitReport(report), "", "  ")
+		content = append([]byte(xml.Header), append(content, '\n')...)
+	case "markdown":
+		content = []byte(markdownReport(report))
+	}
+	if renderErr != nil {
+		logger.Error("failed to render the report", "phase", "report", "error", renderErr)
+		return
+	}
+
+	if reportFile == "" {
+		os.Stdout.Write(content)
+		return
+	}
+
+	writeErr := os.WriteFile(reportFile, content, 0644)
+	if writeErr != nil {
+		logger.Error("failed to write the report", "phase", "report", "error", writeErr)
+		return
+	}
+	logger.Info("report written", "phase", "report", "file", reportFile)
+}
+
+// junitReport turns every app into a test case that fails when any of its phases failed
+func junitReport(report migr8.RunReport) junitTestSuites {
+	suite := junitTestSuite{
+		Name:      "migr8 " + report.Mode,
+		Tests:     len(report.Apps),
+		Failures:  report.Failed,
+		Skipped:   report.Skipped,
+		Time:      junitSeconds(report.DurationSeconds),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+		Cases:     []junitTestCase{},
+	}
+
+	for _, app := range report.Apps {
+		testCase := junitTestCase{Name: app.App, Classname: "migr8." + report.Mode, Time: junitSeconds(app.DurationSeconds)}
+
+		failures := []string{}
+		reasons := []string{}
+		output := []string{}
+		for _, phase := range app.Phases {
+			output = append(output, fmt.Sprintf("%s: %s (%s)", phase.Phase, phase.Status, junitSeconds(phase.DurationSeconds)+"s"))
+			output = append(output, phase.Resources...)
+			if phase.Status == migr8.StatusFailed {
+				failures = append(failures, fmt.Sprintf("%s: %s", phase.Phase, phase.Error))
+			}
+			if phase.Reason != "" {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", phase.Phase, phase.Reason))
+			}
+			if phase.Status == migr8.StatusNotApplicable {
+				reasons = append(reasons, fmt.Sprintf("%s: the run was interrupted before the phase started", phase.Phase))
+			}
+		}
+		if app.RunURL != "" {
+			output = append(output, "pipeline run: "+app.RunURL)
+		}
+		testCase.SystemOut = &junitOutput{Text: strings.Join(output, "\n")}
+
+		switch app.Status {
+		case migr8.StatusFailed:
+			testCase.Failure = &junitFailure{Message: strings.SplitN(failures[0], "\n", 2)[0], Type: "failed", Text: strings.Join(append(failures, reasons...), "\n")}
+		case migr8.StatusSkipped:
+			testCase.Skipped = &junitSkipped{Message: strings.Join(reasons, "; ")}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return junitTestSuites{
+		Name:     "migr8",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+func junitSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// markdownReport renders a table with a column per phase, followed by the errors and the reasons of the skips
+func markdownReport(report migr8.RunReport) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "## migr8 %s report\n\n", report.Mode)
+	fmt.Fprintf(&out, "**%d apps: %d succeeded, %d failed, %d skipped** in %s, started %s\n\n", len(report.Apps), report.Succeeded, report.Failed, report.Skipped,
+		markdownDuration(report.DurationSeconds), report.StartedAt.Format(time.DateTime+" MST"))
+
+	if len(report.Apps) == 0 {
+		return out.String()
+	}
+
+	// apps don't share every phase, e.g. only the apps with a deploy slot have a swap phase
+	phases := []string{}
+	for _, app := range report.Apps {
+		for _, phase := range app.Phases {
+			if !slices.Contains(phases, phase.Phase) {
+				phases = append(phases, phase.Phase)
+			}
+		}
+	}
+
+	header := []string{"App", "Type"}
+	for _, phase := range phases {
+		header = append(header, strings.ToUpper(phase[:1])+phase[1:])
+	}
+	header = append(header, "Duration", "Pipeline run")
+	fmt.Fprintf(&out, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(&out, "|%s\n", strings.Repeat(" --- |", len(header)))
+
+	problems := []string{}
+	for _, app := range report.Apps {
+		row := []string{markdownEscape(app.App), app.Type}
+		for _, name := range phases {
+			index := slices.IndexFunc(app.Phases, func(phase migr8.PhaseReport) bool { return phase.Phase == name })
+			if index == -1 {
+				row = append(row, "")
+				continue
+			}
+			phase := app.Phases[index]
+			row = append(row, markdownStatus(phase.Status))
+			if phase.Error != "" {
+				problems = append(problems, fmt.Sprintf("- **%s** %s failed: %s", markdownEscape(app.App), phase.Phase, markdownEscape(phase.Error)))
+			}
+			if phase.Reason != "" {
+				problems = append(problems, fmt.Sprintf("- **%s** %s skipped: %s", markdownEscape(app.App), phase.Phase, markdownEscape(phase.Reason)))
+			}
+		}
+
+		run := ""
+		if app.RunURL != "" {
+			run = fmt.Sprintf("[run](%s)", app.RunURL)
+		}
+		row = append(row, markdownDuration(app.DurationSeconds), run)
+		fmt.Fprintf(&out, "| %s |\n", strings.Join(row, " | "))
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintf(&out, "\n### Errors and skips\n\n%s\n", strings.Join(problems, "\n"))
+	}
+	return out.String()
+}
+
+func markdownStatus(status string) string {
+	switch status {
+	case migr8.StatusFailed:
+		return "**failed**"
+	case migr8.StatusNotApplicable:
+		return "n/a"
+	}
+	return status
+}
+
+func markdownDuration(seconds float64) string {
+	duration := time.Duration(seconds * float64(time.Second))
+	if duration < time.Second {
+		return duration.Round(time.Millisecond).String()
+	}
+	return duration.Round(time.Second).String()
+}
+
+// markdownEscape keeps an error on a single table cell or list item
+func markdownEscape(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -4,20 +4,50 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
 	"github.com/spf13/cobra"
 )
 
+// the exit codes of migr8
+const (
+	// exitSucceeded ~ every app succeeded, or there was nothing to do
+	exitSucceeded = 0
+	// exitError ~ an unexpected error, e.g. the state file or a report couldn't be written
+	exitError = 1
+	// exitFailed ~ the run finished, but some apps failed while others succeeded
+	exitFailed = 2
+	// exitConfig ~ the config, a flag or the selection of apps is invalid
+	exitConfig = 3
+	// exitAuth ~ the azure login failed or no valid personal access token was found
+	exitAuth = 4
+	// exitAllFailed ~ the run finished, but every app that it worked on failed
+	exitAllFailed = 5
+	// exitInterrupted ~ the run was interrupted by SIGINT or SIGTERM
+	exitInterrupted = 130
+)
+
 var (
 	infraConfigPath string
-	infraConfig     = InfraConfig{}
+	infraConfig     = migr8.InfraConfig{}
 
 	rootCmd = &cobra.Command{Use: "migr8", Version: "1.0.0"}
 )
 
+// failureExitCode returns the exit code for failed out of total apps or resources that a command worked on
+func failureExitCode(failed int, total int) int {
+	switch {
+	case failed == 0:
+		return exitSucceeded
+	case failed >= total:
+		return exitAllFailed
+	}
+	return exitFailed
+}
+
 // Execute starts the root cmd
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitConfig)
 	}
 }
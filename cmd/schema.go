@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/spf13/cobra"
+)
+
+//go:generate go run .. schema --generate --output schema/infraconfig.schema.json
+
+var (
+	// infraConfigSchema is generated from the config types with go generate, so it always matches the binary
+	//go:embed schema/infraconfig.schema.json
+	infraConfigSchema []byte
+
+	schemaOutput   string
+	schemaGenerate bool
+	schemaCmd      = &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the infrastructure configuration",
+		Long: "Print the JSON Schema of the infrastructure configuration. Point your editor to it for autocompletion " +
+			"and validation of the config files",
+		Run:     schemaRun,
+		Version: rootCmd.Version,
+	}
+
+	// schemaDescriptions documents the properties of the config types, keyed by type and json name
+	schemaDescriptions = map[string]string{
+		"InfraConfig":                "The infrastructure to be created and deployed by migr8",
+		"InfraConfig.app":            "The name of the application stack",
+		"InfraConfig.pat":            "Personal Access Token created in Azure DevOPS, or env:NAME to read it from an environment variable. Can be omitted in favor of MIGR8_PAT, patFile or the keyring",
+		"InfraConfig.patFile":        "A file that contains the Personal Access Token. Relative paths are resolved against the config file",
+		"InfraConfig.devopsOrg":      "The azure devops organization your projects belong to, e.g. https://dev.azure.com/<organization name>",
+		"InfraConfig.infrastructure": "The details of the applications to be created and deployed",
+		"InfraConfig.agentPool":      "The agent pool name that should be used for the pipelines",
+		"InfraConfig.environments":   "Overrides per environment, selected with --env. They are deep-merged onto the base config and apps are matched by name",
+		"Environment":                "The overrides of an environment. Apps and settings are matched by name, other lists are replaced",
+		"InfraConfig.retry":          "How failed azure and devops calls of every app are retried",
+		"AppDetails.retry":           "How failed azure and devops calls of this app are retried. Overrides the global retry policy",
+		"RetryPolicy":                "Throttling, server and network errors are retried with an exponential backoff. Any other error fails right away",
+		"RetryPolicy.attempts":       "How many times a call is tried in total. Defaults to 3",
+		"RetryPolicy.baseDelay":      "The delay before the first retry, doubled on every further retry. Defaults to 2s",
+		"RetryPolicy.maxDelay":       "The longest delay between two retries. Defaults to 30s",
+		"RetryPolicy.jitter":         "The fraction that every delay is randomly spread by, between 0 and 1. 0 keeps the delays exact. Defaults to 0.2",
+		"AppDetails.type":            "The type of the application",
+		"AppDetails.name":            "The name of the application. It has to be unique, as it becomes the <name>.azurewebsites.net domain",
+		"AppDetails.storageAccount":  "Only for azure functions. A unique name for a storage account. It will be created if it doesn't exist",
+		"AppDetails.resourceGroup":   "The resource group under which the application will be created. It will be created if it doesn't exist",
+		"AppDetails.location":        "A location name according to the Azure location naming conventions, see az account list-locations",
+		"AppDetails.pipeline":        "The deployment pipeline of the application",
+		"AppDetails.settings":        "The environment variables of the application",
+		"AppDetails.settingsFrom":    "More sources of settings, merged in order: a later source overrides an earlier one and the inline settings override every source",
+		"AppDetails.settingsMode":    "How the settings are applied. app sets them as app settings while the infrastructure is created. pipeline passes them to the pipeline of a webapp as queue-time parameters instead, e.g. for variables needed at build time. Defaults to app",
+		"AppDetails.slots":           "The deployment slots of the application, e.g. staging. They are created with the application",
+		"AppDetails.appServicePlan":  "Only for azure webapps. A unique name for an app service plan. It will be created if it doesn't exist",
+		"AppDetails.runtime":         "A runtime name, see az functionapp list-runtimes and az webapp list-runtimes",
+		"AppDetails.os":              "The operating system of a function app",
+		"AppDetails.labels":          "Free form labels to pick apps with --selector, e.g. tier: frontend",
+		"Pipeline.name":              "The name of an existing (or not) pipeline. If the pipeline does not exist, it will be created",
+		"Pipeline.yamlPath":          "The path to the azure-pipelines.yml file in the repository",
+		"Pipeline.project":           "The project inside the Azure DevOPS organization for which the pipeline will be created",
+		"Pipeline.repository":        "The name of the repository inside the Azure DevOPS project",
+		"Pipeline.branch":            "The name of the branch that the pipeline should be based on",
+		"Pipeline.serviceAccount":    "The service connection that the pipeline deploys with",
+		"AppSettings.name":           "The name of the environment variable",
+		"AppSettings.slotSetting":    "Keep the setting with the deployment slot when slots are swapped",
+		"AppSettings.value":          "The value of the environment variable",
+		"SettingsSource":             "A source of settings. Set exactly one of envFile, app or keyVault",
+		"SettingsSource.envFile":     "A .env file of KEY=VALUE lines. Relative paths are resolved against the config file",
+		"SettingsSource.app":         "Copy the settings of another app of the config",
+		"SettingsSource.keyVault":    "The name of the Key Vault that the secrets are referenced from",
+		"SettingsSource.secrets":     "The settings whose values are Key Vault references. The system assigned identity of the app and of its slots is turned on and allowed to read the secrets",
+		"SettingsSource.slotSetting": "Keep every setting of the source with the deployment slot when slots are swapped",
+		"KeyVaultSecret.name":        "The name of the setting",
+		"KeyVaultSecret.secret":      "The name of the secret in the Key Vault",
+		"KeyVaultSecret.version":     "Pin a version of the secret. Defaults to the latest version",
+		"Slot.name":                  "The name of the slot. It becomes the <name>-<slot>.azurewebsites.net domain",
+		"Slot.deploy":                "Deploy to this slot and swap it into production once it is healthy. Only one slot can be deployed to",
+		"Slot.healthCheckPath":       "The path that has to answer with a 2xx status before the slot is swapped. Defaults to /",
+		"Slot.healthCheckTimeout":    "How long the slot may take to become healthy, e.g. 5m. Defaults to 5m",
+		"Slot.settings":              "Settings that override the ones of the app on this slot or that only this slot has. They always stay with the slot when slots are swapped",
+	}
+
+	// schemaRequired lists the required properties of the config types. It mirrors the checks of validate
+	schemaRequired = map[string][]string{
+		"InfraConfig":    {"devopsOrg", "infrastructure"},
+		"AppDetails":     {"type", "name", "resourceGroup"},
+		"AppSettings":    {"name"},
+		"Slot":           {"name"},
+		"KeyVaultSecret": {"name", "secret"},
+	}
+
+	// schemaKeywords adds constraints to single properties, keyed by type and json name
+	schemaKeywords = map[string]map[string]interface{}{
+		"AppDetails.type":           {"enum": migr8.AppTypes},
+		"AppDetails.storageAccount": {"pattern": migr8.StorageAccountPattern},
+		"AppDetails.settingsMode":   {"enum": migr8.SettingsModes},
+		"Slot.name":                 {"pattern": migr8.SlotNamePattern},
+		"SettingsSource.keyVault":   {"pattern": migr8.KeyVaultNamePattern},
+		"KeyVaultSecret.name":       {"pattern": migr8.SettingNamePattern},
+		"KeyVaultSecret.secret":     {"pattern": migr8.KeyVaultSecretPattern},
+		"RetryPolicy.attempts":      {"minimum": 1},
+		"RetryPolicy.jitter":        {"minimum": 0, "maximum": 1},
+	}
+
+	// schemaPartial marks the types that are merged onto the base config. Nothing nested in them is required
+	schemaPartial = map[string]bool{"Environment": true}
+)
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "Write the schema to a file instead of stdout")
+	schemaCmd.Flags().BoolVar(&schemaGenerate, "generate", false, "Generate the schema from the config types instead of printing the embedded one")
+	schemaCmd.Flags().MarkHidden("generate")
+
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func schemaRun(cmd *cobra.Command, args []string) {
+	schema := infraConfigSchema
+	if schemaGenerate {
+		generated, err := json.MarshalIndent(buildSchema(), "", "  ")
+		if err != nil {
+			logger.Error("failed to generate the schema", "phase", "schema", "error", err)
+			os.Exit(exitError)
+		}
+		schema = append(generated, '\n')
+	}
+
+	if schemaOutput == "" {
+		os.Stdout.Write(schema)
+		return
+	}
+
+	writeErr := os.WriteFile(schemaOutput, schema, 0644)
+	if writeErr != nil {
+		logger.Error("failed to write the schema", "phase", "schema", "error", writeErr)
+		os.Exit(exitError)
+	}
+	logger.Info("schema written", "phase", "schema", "file", schemaOutput)
+}
+
+// buildSchema generates the JSON Schema of InfraConfig from the json tags of the config types
+func buildSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	root := schemaObject(reflect.TypeOf(migr8.InfraConfig{}), defs, false)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "migr8 infrastructure configuration"
+	root["$defs"] = defs
+	// lets json configs point their editor to the schema
+	root["properties"].(map[string]interface{})["$schema"] = map[string]interface{}{"type": "string", "description": "The JSON Schema of the config"}
+
+	defs["AppDetails"].(map[string]interface{})["allOf"] = []interface{}{
+		requiredForType("function", "storageAccount"),
+		requiredForType("webapp", "appServicePlan"),
+	}
+
+	return root
+}
+
+// requiredForType makes a property required only for apps of the given type
+func requiredForType(appType string, property string) map[string]interface{} {
+	return map[string]interface{}{
+		"if": map[string]interface{}{
+			"properties": map[string]interface{}{"type": map[string]interface{}{"const": appType}},
+			"required":   []string{"type"},
+		},
+		"then": map[string]interface{}{"required": []string{property}},
+	}
+}
+
+// schemaObject describes a struct type. Nested struct types are added to defs and referenced. A partial
+// object has no required properties
+func schemaObject(model reflect.Type, defs map[string]interface{}, partial bool) map[string]interface{} {
+	partial = partial || schemaPartial[model.Name()]
+
+	properties := map[string]interface{}{}
+	for i := 0; i < model.NumField(); i++ {
+		name := strings.Split(model.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		property := schemaType(model.Field(i).Type, defs, partial)
+		if description, ok := schemaDescriptions[model.Name()+"."+name]; ok {
+			property["description"] = description
+		}
+		for keyword, value := range schemaKeywords[model.Name()+"."+name] {
+			property[keyword] = value
+		}
+		properties[name] = property
+	}
+
+	object := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[model.Name()]; ok && !partial {
+		object["required"] = required
+	}
+	if description, ok := schemaDescriptions[model.Name()]; ok {
+		object["description"] = description
+	}
+	return object
+}
+
+// schemaType describes any type of a config field
+func schemaType(model reflect.Type, defs map[string]interface{}, partial bool) map[string]interface{} {
+	switch model.Kind() {
+	case reflect.Struct:
+		// a partial variant of a type with required properties is a separate definition
+		name := model.Name()
+		if partial && len(schemaRequired[name]) > 0 {
+			name += "Override"
+		}
+		if _, ok := defs[name]; !ok {
+			// reserve the name first, so that recursive types terminate
+			defs[name] = nil
+			defs[name] = schemaObject(model, defs, partial)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaType(model.Elem(), defs, partial)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaType(model.Elem(), defs, partial)}
+	case reflect.Pointer:
+		return schemaType(model.Elem(), defs, partial)
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
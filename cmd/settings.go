@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/fatih/color"
+	prettyTable "github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	settingsOutput     string
+	settingsShowValues bool
+	settingsExitCode   bool
+	settingsPrune      bool
+	settingsYes        bool
+	settingsCmd        = &cobra.Command{
+		Use:              "settings",
+		Short:            "Compare and sync the app settings of an application stack with the live apps",
+		Long:             "Compare and sync the app settings of an application stack with the live apps and their deployment slots",
+		PersistentPreRun: settingsPrerun,
+		Version:          rootCmd.Version,
+	}
+	settingsDiffCmd = &cobra.Command{
+		Use:   "diff",
+		Short: "Show the settings that were added, removed or changed on the live apps",
+		Long: "Show the settings that were added, removed or changed on the live apps and their deployment slots compared " +
+			"to the configuration. Values are masked unless --show-values is set. Settings managed by Azure, e.g. WEBSITE_* " +
+			"and FUNCTIONS_*, are left out unless the configuration declares them",
+		Run:     settingsDiffRun,
+		Version: rootCmd.Version,
+	}
+	settingsSyncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Make the settings of the live apps match the configuration",
+		Long: "Make the settings of the live apps and their deployment slots match the configuration. Added and changed " +
+			"settings are set, settings that the configuration doesn't declare are only deleted with --prune",
+		Run:     settingsSyncRun,
+		Version: rootCmd.Version,
+	}
+)
+
+func init() {
+	settingsCmd.PersistentFlags().StringVarP(&infraConfigPath, "infraConfig", "i", "", "The infrastructre configuration whose settings are compared")
+	settingsCmd.MarkPersistentFlagRequired("infraConfig")
+	settingsCmd.PersistentFlags().StringVar(&configEnv, "env", "", "The environment whose overrides are merged onto the configuration, e.g. --env staging")
+	settingsCmd.PersistentFlags().StringSliceVar(&onlyApps, "only", nil, "Only work on the given apps, e.g. --only api,web")
+	settingsCmd.PersistentFlags().StringSliceVar(&skipApps, "skip", nil, "Leave out the given apps, e.g. --skip legacy")
+	settingsCmd.PersistentFlags().StringSliceVar(&selectors, "selector", nil, "Only work on the apps whose labels match every selector, e.g. --selector tier=frontend,region!=us")
+	settingsCmd.PersistentFlags().StringArrayVar(&configVars, "var", nil, "Set a variable for the ${VAR} placeholders of the configuration, e.g. --var ENV=prod. Overrides the environment")
+	settingsCmd.PersistentFlags().BoolVar(&settingsShowValues, "show-values", false, "Print the values of the settings instead of masking them")
+
+	settingsDiffCmd.Flags().StringVarP(&settingsOutput, "output", "o", "table", "The output format of the diff: table | json")
+	settingsDiffCmd.Flags().BoolVar(&settingsExitCode, "exit-code", false, "Exit with 2 when the live settings differ from the configuration")
+	settingsSyncCmd.Flags().BoolVar(&settingsPrune, "prune", false, "Delete the live settings that the configuration doesn't declare")
+	settingsSyncCmd.Flags().BoolVarP(&settingsYes, "yes", "y", false, "Skip the confirmation prompt")
+
+	settingsCmd.AddCommand(settingsDiffCmd)
+	settingsCmd.AddCommand(settingsSyncCmd)
+	rootCmd.AddCommand(settingsCmd)
+}
+
+func settingsPrerun(cmd *cobra.Command, args []string) {
+	if !slices.Contains([]string{"table", "json"}, settingsOutput) {
+		logger.Error("unknown output", "phase", migr8.PhaseSettings, "output", settingsOutput, "hint", "use table | json")
+		os.Exit(exitConfig)
+	}
+
+	// keep stdout clean for the machine-readable diff
+	if settingsOutput == "json" {
+		color.Output = os.Stderr
+	}
+
+	loadConfig()
+	// the settings are read and written with az only, so there is no need to select a subscription
+	azureLogin()
+}
+
+func settingsDiffRun(cmd *cobra.Command, args []string) {
+	diffs := infraRunner.DiffSettings(cmd.Context())
+
+	if settingsOutput == "json" {
+		out, err := json.MarshalIndent(maskSettings(diffs), "", "  ")
+		if err != nil {
+			logger.Error("failed to marshal the diff", "phase", migr8.PhaseSettings, "error", err)
+			os.Exit(exitError)
+		}
+		fmt.Println(string(out))
+	} else {
+		printSettings("MIGR8 SETTINGS DIFF", diffs, false)
+	}
+
+	if exitCode := settingsFailureExitCode(diffs); exitCode != exitSucceeded {
+		os.Exit(exitCode)
+	}
+	for _, diff := range diffs {
+		if settingsExitCode && diff.Status == migr8.SettingsDrifted {
+			os.Exit(exitFailed)
+		}
+	}
+}
+
+func settingsSyncRun(cmd *cobra.Command, args []string) {
+	diffs := infraRunner.DiffSettings(cmd.Context())
+	printSettings("MIGR8 SETTINGS DIFF", diffs, false)
+
+	drifted := 0
+	for _, diff := range diffs {
+		if diff.Status == migr8.SettingsDrifted {
+			drifted++
+		}
+	}
+	if drifted == 0 {
+		logger.Info("the live settings match the config. Nothing to sync", "phase", migr8.PhaseSettings)
+		return
+	}
+
+	question := fmt.Sprintf("Update the settings of %d apps and slots?", drifted)
+	if settingsPrune {
+		question = fmt.Sprintf("Update the settings of %d apps and slots and delete the undeclared ones?", drifted)
+	}
+	if !settingsYes && !Confirm(question) {
+		logger.Warn("sync aborted. Nothing was changed", "phase", migr8.PhaseSettings)
+		return
+	}
+
+	results := infraRunner.SyncSettings(cmd.Context(), diffs, settingsPrune)
+	printSettings("MIGR8 SETTINGS SYNC RESULTS", results, true)
+
+	os.Exit(settingsFailureExitCode(results))
+}
+
+// settingsFailureExitCode tells CI how many apps and slots failed. Skipped ones don't count
+func settingsFailureExitCode(diffs []migr8.SettingsDiff) int {
+	failed, total := 0, 0
+	for _, diff := range diffs {
+		if diff.Status == migr8.StatusFailed {
+			failed++
+		}
+		if diff.Status != migr8.StatusSkipped {
+			total++
+		}
+	}
+	return failureExitCode(failed, total)
+}
+
+// maskSettings replaces every value of the diffs with *** unless --show-values is set. Empty values stay empty
+func maskSettings(diffs []migr8.SettingsDiff) []migr8.SettingsDiff {
+	if settingsShowValues {
+		return diffs
+	}
+
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return "***"
+	}
+
+	masked := make([]migr8.SettingsDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		changes := make([]migr8.SettingChange, 0, len(diff.Changes))
+		for _, change := range diff.Changes {
+			change.Live = mask(change.Live)
+			change.Declared = mask(change.Declared)
+			changes = append(changes, change)
+		}
+		diff.Changes = changes
+		masked = append(masked, diff)
+	}
+	return masked
+}
+
+// describeSticky marks the value of a slot setting, so that a change of the flag alone shows up in the table
+func describeSticky(value string, isSticky bool) string {
+	if !isSticky {
+		return value
+	}
+	return strings.TrimSpace(value + " (slot setting)")
+}
+
+// printSettings prints a diff, or the results of a sync along with how many apps and slots were synced
+func printSettings(title string, diffs []migr8.SettingsDiff, isSync bool) {
+	t := prettyTable.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+
+	color.Cyan("\n############### %s ##############\n", title)
+
+	t.AppendHeader(prettyTable.Row{"APP NAME", "STATUS", "SETTING", "CHANGE", "LIVE", "CONFIG", "NOTE"})
+	t.SetColumnConfigs([]prettyTable.ColumnConfig{{Number: 1, AutoMerge: true}})
+
+	counts := map[string]int{}
+	for _, diff := range maskSettings(diffs) {
+		counts[diff.Status]++
+		target := strings.TrimSuffix(diff.App+"/"+diff.Slot, "/")
+		note := strings.TrimSpace(diff.Error + "\n" + diff.Note)
+
+		if len(diff.Changes) == 0 {
+			t.AppendRow(prettyTable.Row{target, strings.ToUpper(diff.Status), "", "", "", "", note})
+		}
+		for i, change := range diff.Changes {
+			counts[change.Action]++
+			// the note belongs to the app, so it is only shown once
+			if i > 0 {
+				note = ""
+			}
+			live, declared := describeSticky(change.Live, change.LiveSlotSetting), describeSticky(change.Declared, change.SlotSetting)
+			t.AppendRow(prettyTable.Row{target, strings.ToUpper(diff.Status), change.Name, change.Action, live, declared, note})
+		}
+		t.AppendSeparator()
+	}
+
+	t.Render()
+
+	if isSync {
+		color.Cyan("RESULTS: %d SYNCED, %d FAILED, %d STILL DRIFTED", counts[migr8.SettingsSynced], counts[migr8.StatusFailed], counts[migr8.SettingsDrifted])
+		return
+	}
+	color.Cyan("SETTINGS: %d TO ADD, %d TO CHANGE, %d TO REMOVE", counts["add"], counts["change"], counts["remove"])
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/G-MAKROGLOU/migr8/pkg/migr8"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check an infrastructure configuration for mistakes",
+		Long: "Check an infrastructure configuration for mistakes and report every error along with its json path. " +
+			"Nothing is looked up in Azure, so neither an Azure login nor Docker is needed",
+		Run:     validateRun,
+		Version: rootCmd.Version,
+	}
+)
+
+func init() {
+	validateCmd.Flags().StringVarP(&infraConfigPath, "infraConfig", "i", "", "The infrastructre configuration to be validated")
+	validateCmd.MarkFlagRequired("infraConfig")
+	validateCmd.Flags().StringVar(&configEnv, "env", "", "The environment whose overrides are merged onto the configuration before it is validated")
+	validateCmd.Flags().StringArrayVar(&configVars, "var", nil, "Set a variable for the ${VAR} placeholders of the configuration, e.g. --var ENV=prod. Overrides the environment")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateRun(cmd *cobra.Command, args []string) {
+	readInfraConfig()
+
+	validationErrs := migr8.ApplyEnvironment(infraConfigPath, configEnv, &infraConfig)
+	validationErrs = append(validationErrs, migr8.InterpolateConfig(&infraConfig, configVars)...)
+	validationErrs = append(validationErrs, migr8.ResolveSettings(infraConfigPath, &infraConfig, configVars)...)
+	validationErrs = append(validationErrs, migr8.CheckConfig(infraConfigPath, infraConfig)...)
+	if len(validationErrs) > 0 {
+		printValidationErrors(validationErrs)
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("the config is valid", "phase", "validate", "config", infraConfigPath)
+}
+
+func printValidationErrors(validationErrs []migr8.ValidationError) {
+	for _, validationErr := range validationErrs {
+		logger.Error("invalid", "phase", "validate", "path", validationErr.Path, "error", validationErr.Message)
+	}
+	logger.Error(fmt.Sprintf("the config has %d errors", len(validationErrs)), "phase", "validate", "config", infraConfigPath)
+}
@@ -7,12 +7,14 @@ require (
 	github.com/G-MAKROGLOU/devops v0.0.0-20240713230334-32dfd3e599a2
 	github.com/G-MAKROGLOU/infrastructure v0.0.0-20240713215514-c87060ef9528
 	github.com/fatih/color v1.17.0
+	github.com/goccy/go-yaml v1.11.3
 	github.com/jedib0t/go-pretty/v6 v6.5.9
+	github.com/pelletier/go-toml/v2 v2.2.2
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/term v0.22.0
 )
 
 require (
-	github.com/Azure/go-ansiterm v0.0.0-20230124172434-306776ec8161 // indirect
 	github.com/Microsoft/go-winio v0.6.2 // indirect
 	github.com/containerd/containerd v1.7.19 // indirect
 	github.com/containerd/log v0.1.0 // indirect
@@ -45,4 +47,5 @@ require (
 	go.opentelemetry.io/otel/trace v1.28.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
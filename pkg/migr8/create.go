@@ -0,0 +1,94 @@
+package migr8
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/G-MAKROGLOU/infrastructure/azpipelines"
+)
+
+// the az commands below run with the context of the phase, so a cancelled or timed out phase kills them instead of
+// leaving them to create resources in the background. Every create is skipped when the resource already exists
+
+// createResourceGroup creates the resource group of an app
+func createResourceGroup(ctx context.Context, app AppDetails) error {
+	isFound, err := resourceGroupExists(ctx, app.ResourceGroup)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "group", "create", "--name", app.ResourceGroup, "--location", app.Location)
+}
+
+// createStorageAccount creates the storage account of a function app
+func createStorageAccount(ctx context.Context, app AppDetails) error {
+	isFound, err := storageAccountExists(ctx, app.StorageAccount)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "storage", "account", "create", "--name", app.StorageAccount, "--location", app.Location, "--resource-group", app.ResourceGroup,
+		"--sku", "Standard_LRS", "--allow-blob-public-access", "false")
+}
+
+// createAppServicePlan creates the app service plan of a webapp
+func createAppServicePlan(ctx context.Context, app AppDetails) error {
+	isFound, err := appServicePlanExists(ctx, app.AppServicePlan)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "appservice", "plan", "create", "--name", app.AppServicePlan, "--resource-group", app.ResourceGroup, "--location", app.Location,
+		"--sku", "F1", "--per-site-scaling", "true")
+}
+
+// createFunctionApp creates a function app on a consumption plan
+func createFunctionApp(ctx context.Context, app AppDetails) error {
+	isFound, err := functionAppExists(ctx, app.Name)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "functionapp", "create", "--name", app.Name, "--resource-group", app.ResourceGroup, "--consumption-plan-location", app.Location,
+		"--runtime", app.Runtime, "--os-type", app.Os, "--functions-version", "4", "--storage-account", app.StorageAccount)
+}
+
+// createWebApp creates a webapp on its app service plan
+func createWebApp(ctx context.Context, app AppDetails) error {
+	isFound, err := webAppExists(ctx, app.Name)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "webapp", "create", "--name", app.Name, "--resource-group", app.ResourceGroup, "--plan", app.AppServicePlan, "--runtime", app.Runtime)
+}
+
+// createPipeline creates the pipeline of an app from its yaml file without running it
+func createPipeline(ctx context.Context, devopsOrg string, app AppDetails) error {
+	isFound, err := pipelineExists(ctx, devopsOrg, app.Pipeline.Project, app.Pipeline.Name)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, "pipelines", "create", "--name", app.Pipeline.Name, "--yaml-path", app.Pipeline.YamlPath, "--project", app.Pipeline.Project,
+		"--repository", app.Pipeline.Repository, "--organization", devopsOrg, "--repository-type", "tfsgit", "--branch", app.Pipeline.Branch, "--skip-run")
+}
+
+// queuePipeline queues a run of the pipeline of an app with the given parameters
+func queuePipeline(ctx context.Context, devopsOrg string, app AppDetails, parameters []string) (PipelineRun, error) {
+	args := []string{"pipelines", "run", "--name", app.Pipeline.Name, "--project", app.Pipeline.Project, "--organization", devopsOrg,
+		"--query", "{id:id, status:status || state, result:result}"}
+	if len(parameters) > 0 {
+		args = append(append(args, "--parameters"), parameters...)
+	}
+
+	status, err := azQuery[azpipelines.PipelineStatus](ctx, args...)
+	if err != nil {
+		return PipelineRun{}, err
+	}
+	return PipelineRun{ID: status.ID, Status: status.Status, Result: status.Result, URL: pipelineRunURL(devopsOrg, app.Pipeline.Project, status.ID)}, nil
+}
+
+// pipelineRun returns the status and result of a pipeline run
+func pipelineRun(ctx context.Context, devopsOrg string, project string, runID int) (PipelineRun, error) {
+	status, err := azQuery[azpipelines.PipelineStatus](ctx, "pipelines", "build", "show", "--id", strconv.Itoa(runID), "--organization", devopsOrg,
+		"--project", project, "--query", "{id:id, status:status, result:result}")
+	if err != nil {
+		return PipelineRun{}, err
+	}
+	return PipelineRun{ID: status.ID, Status: status.Status, Result: status.Result, URL: pipelineRunURL(devopsOrg, project, status.ID)}, nil
+}
@@ -0,0 +1,46 @@
+package migr8
+
+import (
+	"context"
+	"strconv"
+)
+
+// deleteResourceGroup deletes a resource group and everything left in it
+func deleteResourceGroup(ctx context.Context, name string) error {
+	return azRun(ctx, "group", "delete", "--name", name, "--yes")
+}
+
+// deleteStorageAccount deletes a storage account
+func deleteStorageAccount(ctx context.Context, name string, resourceGroup string) error {
+	return azRun(ctx, "storage", "account", "delete", "--name", name, "--resource-group", resourceGroup, "--yes")
+}
+
+// deleteAppServicePlan deletes an app service plan
+func deleteAppServicePlan(ctx context.Context, name string, resourceGroup string) error {
+	return azRun(ctx, "appservice", "plan", "delete", "--name", name, "--resource-group", resourceGroup, "--yes")
+}
+
+// deleteFunctionApp deletes a function app
+func deleteFunctionApp(ctx context.Context, name string, resourceGroup string) error {
+	return azRun(ctx, "functionapp", "delete", "--name", name, "--resource-group", resourceGroup)
+}
+
+// deleteWebApp deletes a webapp but keeps its app service plan even if it is left empty. Plans are deleted
+// separately once nothing references them anymore
+func deleteWebApp(ctx context.Context, name string, resourceGroup string) error {
+	return azRun(ctx, "webapp", "delete", "--name", name, "--resource-group", resourceGroup, "--keep-empty-plan")
+}
+
+// deletePipeline deletes a pipeline definition from a devops project
+func deletePipeline(ctx context.Context, devopsOrg string, project string, name string) error {
+	id, idErr := pipelineID(ctx, devopsOrg, project, name)
+	if idErr != nil {
+		return idErr
+	}
+	return azRun(ctx, "pipelines", "delete", "--organization", devopsOrg, "--project", project, "--id", strconv.Itoa(id), "--yes")
+}
+
+// cancelPipelineRun cancels a queued or running pipeline run
+func cancelPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) error {
+	return azRun(ctx, "pipelines", "build", "cancel", "--organization", devopsOrg, "--project", project, "--build-id", strconv.Itoa(runID))
+}
@@ -0,0 +1,298 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// companionTypes are the resource types that Azure creates along with an app, e.g. the application insights of a
+// function app and its smart detection alerts. They don't keep a resource group alive. Types are compared in
+// lower case, since az isn't consistent about it
+var companionTypes = []string{
+	"microsoft.insights/components",
+	"microsoft.insights/actiongroups",
+	"microsoft.alertsmanagement/smartdetectoralertrules",
+}
+
+// UnreadableAppsError ~ the apps whose settings couldn't be read while looking up what uses a resource. Destroy
+// counts them as users and keeps the resource, since they might still need it
+type UnreadableAppsError struct {
+	Apps map[string]error
+}
+
+func (err *UnreadableAppsError) Error() string {
+	apps := make([]string, 0, len(err.Apps))
+	for app := range err.Apps {
+		apps = append(apps, app)
+	}
+	slices.Sort(apps)
+	return "failed to read the settings of " + strings.Join(apps, ", ")
+}
+
+// teardownTarget ~ a single resource that destroy may delete
+type teardownTarget struct {
+	resource string
+	name     string
+	exists   func(ctx context.Context) (bool, error)
+	remove   func(ctx context.Context) error
+	// references returns what still uses a shared resource. It is nil for resources that can't be shared
+	references func(ctx context.Context) ([]string, error)
+}
+
+// Destroy deletes every resource of the config in reverse dependency order: pipelines, apps, app service plans
+// and storage accounts, resource groups. Shared resources that are still used by apps outside the config are
+// kept, and so are the resources that the state records as reused unless Options.ForceDestroy is set. Options.ConfirmDestroy is asked once the resources were looked up, and ErrAborted is returned when it
+// declines
+func (runner *Runner) Destroy(ctx context.Context) ([]DestroyResult, error) {
+	results := []DestroyResult{}
+	phases := [][]teardownTarget{}
+	pending := []DestroyResult{}
+
+	runner.diagnose(slog.LevelInfo, PhaseDestroy, "", "looking up resources to destroy", nil)
+
+	for _, phase := range runner.buildTeardown() {
+		existing := []teardownTarget{}
+		for _, target := range phase {
+			isFound, err := target.exists(ctx)
+			if err != nil {
+				runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Message: "failed to look up", Err: err})
+				results = append(results, DestroyResult{Resource: target.resource, Name: target.name, Status: "FAILED", Note: "lookup failed: " + err.Error()})
+				continue
+			}
+			if !isFound {
+				results = append(results, DestroyResult{Resource: target.resource, Name: target.name, Status: "NOT FOUND"})
+				continue
+			}
+			// a resource that existed before migr8 belongs to someone else, even if only the config uses it now
+			if recorded, isRecorded := runner.state.findResource(target.resource, target.name); isRecorded && recorded.Action == "reused" && !runner.Options.ForceDestroy {
+				result := DestroyResult{Resource: target.resource, Name: target.name, Status: "KEPT", Note: "reused: it existed before migr8"}
+				runner.emit(ResourceSkipped{Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Reason: result.Note})
+				results = append(results, result)
+				continue
+			}
+			existing = append(existing, target)
+			pending = append(pending, DestroyResult{Resource: target.resource, Name: target.name, Status: "PENDING", Note: runner.state.describeResource(target.resource, target.name)})
+		}
+		phases = append(phases, existing)
+	}
+
+	if len(pending) == 0 {
+		runner.diagnose(slog.LevelWarn, PhaseDestroy, "", "nothing to destroy", nil)
+		return results, nil
+	}
+
+	if runner.Options.ConfirmDestroy != nil && !runner.Options.ConfirmDestroy(pending) {
+		return results, ErrAborted
+	}
+
+	for _, phase := range phases {
+		for _, target := range phase {
+			results = append(results, runner.teardown(ctx, target))
+		}
+	}
+
+	return results, nil
+}
+
+// buildTeardown groups every resource of the config in the order they have to be deleted in. Resources that
+// are shared by several apps appear only once
+func (runner *Runner) buildTeardown() [][]teardownTarget {
+	pipelines := []teardownTarget{}
+	apps := []teardownTarget{}
+	hosts := []teardownTarget{}
+	resourceGroups := []teardownTarget{}
+	seen := map[string]bool{}
+
+	isNew := func(resource string, name string) bool {
+		key := resource + "/" + name
+		if name == "" || seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+
+	for _, appDetails := range runner.Config.Infrastructure {
+		app := appDetails
+
+		if app.Pipeline.Name != "" && isNew("pipeline", app.Pipeline.Project+"/"+app.Pipeline.Name) {
+			pipelines = append(pipelines, teardownTarget{
+				resource: "pipeline",
+				name:     app.Pipeline.Name,
+				exists: func(ctx context.Context) (bool, error) {
+					return runner.Pipelines.PipelineExists(ctx, runner.Config.DevOpsOrg, app.Pipeline)
+				},
+				remove: func(ctx context.Context) error {
+					return runner.Pipelines.DeletePipeline(ctx, runner.Config.DevOpsOrg, app.Pipeline)
+				},
+			})
+		}
+
+		if app.Type == "function" {
+			if isNew("function app", app.Name) {
+				apps = append(apps, teardownTarget{
+					resource: "function app",
+					name:     app.Name,
+					exists: func(ctx context.Context) (bool, error) {
+						return runner.Provisioner.FunctionAppExists(ctx, app.Name)
+					},
+					remove: func(ctx context.Context) error {
+						return runner.Provisioner.DeleteFunctionApp(ctx, app)
+					},
+				})
+			}
+			if isNew("storage account", app.StorageAccount) {
+				hosts = append(hosts, teardownTarget{
+					resource: "storage account",
+					name:     app.StorageAccount,
+					exists: func(ctx context.Context) (bool, error) {
+						return runner.Provisioner.StorageAccountExists(ctx, app.StorageAccount)
+					},
+					remove: func(ctx context.Context) error {
+						return runner.Provisioner.DeleteStorageAccount(ctx, app)
+					},
+					references: func(ctx context.Context) ([]string, error) {
+						return runner.Provisioner.StorageAccountApps(ctx, app)
+					},
+				})
+			}
+		}
+
+		if app.Type == "webapp" {
+			if isNew("webapp", app.Name) {
+				apps = append(apps, teardownTarget{
+					resource: "webapp",
+					name:     app.Name,
+					exists: func(ctx context.Context) (bool, error) {
+						return runner.Provisioner.WebAppExists(ctx, app.Name)
+					},
+					remove: func(ctx context.Context) error {
+						return runner.Provisioner.DeleteWebApp(ctx, app)
+					},
+				})
+			}
+			if app.AppServicePlan != "" && isNew("app service plan", app.ResourceGroup+"/"+app.AppServicePlan) {
+				hosts = append(hosts, teardownTarget{
+					resource: "app service plan",
+					name:     app.AppServicePlan,
+					exists: func(ctx context.Context) (bool, error) {
+						return runner.Provisioner.AppServicePlanExists(ctx, app.AppServicePlan)
+					},
+					remove: func(ctx context.Context) error {
+						return runner.Provisioner.DeleteAppServicePlan(ctx, app)
+					},
+					references: func(ctx context.Context) ([]string, error) {
+						return runner.Provisioner.AppServicePlanApps(ctx, app)
+					},
+				})
+			}
+		}
+
+		if isNew("resource group", app.ResourceGroup) {
+			resourceGroups = append(resourceGroups, teardownTarget{
+				resource: "resource group",
+				name:     app.ResourceGroup,
+				exists: func(ctx context.Context) (bool, error) {
+					return runner.Provisioner.ResourceGroupExists(ctx, app.ResourceGroup)
+				},
+				remove: func(ctx context.Context) error {
+					return runner.Provisioner.DeleteResourceGroup(ctx, app.ResourceGroup)
+				},
+				references: func(ctx context.Context) ([]string, error) {
+					return runner.foreignResources(ctx, app.ResourceGroup)
+				},
+			})
+		}
+	}
+
+	return [][]teardownTarget{pipelines, apps, hosts, resourceGroups}
+}
+
+// foreignResources returns the resources of a resource group that don't belong to any app of the config. The
+// apps and slots of the config and the companion resources that Azure creates along with an app are owned,
+// whatever they are called. So is the plan that Azure creates for a consumption function app, which has the
+// Dynamic tier. The plans and storage accounts of the config are only left by now when something still uses them,
+// so they keep the resource group
+func (runner *Runner) foreignResources(ctx context.Context, resourceGroup string) ([]string, error) {
+	resources, err := runner.Provisioner.ResourceGroupResources(ctx, resourceGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	foreign := []string{}
+	for _, resource := range resources {
+		if !runner.isOwned(resource) {
+			foreign = append(foreign, resource.Name)
+		}
+	}
+	return foreign, nil
+}
+
+// isOwned checks if a resource that is left in a resource group belongs to the apps of the config
+func (runner *Runner) isOwned(resource AzureResource) bool {
+	resourceType := strings.ToLower(resource.Type)
+	if slices.Contains(companionTypes, resourceType) {
+		return true
+	}
+	if resourceType == "microsoft.web/serverfarms" && strings.EqualFold(resource.SkuTier, "Dynamic") {
+		return true
+	}
+
+	// slots are listed as app/slot
+	appName, _, _ := strings.Cut(resource.Name, "/")
+	return slices.ContainsFunc(runner.Config.Infrastructure, func(app AppDetails) bool { return app.Name == appName })
+}
+
+// teardown deletes a single resource unless something still uses it
+func (runner *Runner) teardown(ctx context.Context, target teardownTarget) DestroyResult {
+	result := DestroyResult{Resource: target.resource, Name: target.name, Status: "DELETED"}
+
+	if target.references != nil {
+		users, err := target.references(ctx)
+		// an app that might use the resource keeps it, like the apps that do
+		var unreadable *UnreadableAppsError
+		if errors.As(err, &unreadable) {
+			for app, readErr := range unreadable.Apps {
+				runner.emit(Diagnostic{Level: slog.LevelWarn, Phase: PhaseDestroy, Resource: target.resource, Name: target.name,
+					Message: fmt.Sprintf("failed to check if %s uses", app), Err: readErr})
+			}
+			result.Status = "KEPT"
+			result.Note = err.Error()
+			if len(users) > 0 {
+				result.Note = "still used by " + strings.Join(users, ", ") + ". " + result.Note
+			}
+			runner.emit(ResourceSkipped{Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Reason: result.Note})
+			return result
+		}
+		if err != nil {
+			runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Message: "failed to check what uses", Err: err})
+			result.Status = "FAILED"
+			result.Note = "reference check failed: " + err.Error()
+			return result
+		}
+		if len(users) > 0 {
+			result.Status = "KEPT"
+			result.Note = "still used by " + strings.Join(users, ", ")
+			runner.emit(ResourceSkipped{Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Reason: result.Note})
+			return result
+		}
+	}
+
+	runner.emit(Diagnostic{Level: slog.LevelInfo, Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Message: "deleting"})
+
+	err := target.remove(ctx)
+	if err != nil {
+		runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseDestroy, Resource: target.resource, Name: target.name, Message: "failed to delete", Err: err})
+		result.Status = "FAILED"
+		result.Note = err.Error()
+		return result
+	}
+
+	runner.emit(ResourceDeleted{Resource: target.resource, Name: target.name})
+	runner.state.forgetResource(target.resource, target.name)
+	return result
+}
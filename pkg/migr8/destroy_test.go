@@ -0,0 +1,105 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// destroyResult returns the result of destroying a resource, or fails if it wasn't looked at
+func destroyResult(t *testing.T, results []DestroyResult, resource string, name string) DestroyResult {
+	t.Helper()
+
+	index := slices.IndexFunc(results, func(result DestroyResult) bool { return result.Resource == resource && result.Name == name })
+	if index == -1 {
+		t.Fatalf("%s %s is missing from %v", resource, name, results)
+	}
+	return results[index]
+}
+
+func TestDestroyDeletesTheResourceGroupWithTheCompanionResources(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	if _, err := runner.Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// what azure creates along with a function app on a consumption plan
+	fake.create("Seed", "application insights", "api-insights", "rg")
+	fake.create("Seed", "consumption plan", "WestEuropePlan", "rg")
+
+	results, err := runner.Destroy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := destroyResult(t, results, "resource group", "rg"); result.Status != "DELETED" {
+		t.Errorf("the resource group is %s, want DELETED (note: %s)", result.Status, result.Note)
+	}
+}
+
+func TestDestroyKeepsTheResourceGroupOfForeignResources(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	if _, err := runner.Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fake.create("Seed", "webapp", "legacy", "rg")
+
+	results, err := runner.Destroy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := destroyResult(t, results, "resource group", "rg")
+	if result.Status != "KEPT" || !strings.Contains(result.Note, "legacy") {
+		t.Errorf("the resource group is %s (note: %s), want KEPT for legacy", result.Status, result.Note)
+	}
+}
+
+func TestDestroyKeepsStorageAccountsWhoseUsersCantBeRead(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	if _, err := runner.Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fake.fail("StorageAccountApps", "storage account/apisa", &UnreadableAppsError{Apps: map[string]error{"other": errors.New("AuthorizationFailed")}})
+
+	results, err := runner.Destroy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := destroyResult(t, results, "storage account", "apisa")
+	if result.Status != "KEPT" || !strings.Contains(result.Note, "other") {
+		t.Errorf("the storage account is %s (note: %s), want KEPT for other", result.Status, result.Note)
+	}
+	if slices.Contains(fake.calls, "DeleteStorageAccount/apisa") {
+		t.Errorf("the storage account was deleted")
+	}
+}
+
+func TestDestroyKeepsReusedResourcesUnlessForced(t *testing.T) {
+	for _, isForced := range []bool{false, true} {
+		fake := newFakeBackend("resource group/rg")
+		runner := newTestRunner(t, fake, Options{ForceDestroy: isForced})
+		if _, err := runner.Create(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := runner.Destroy(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "KEPT"
+		if isForced {
+			want = "DELETED"
+		}
+		if result := destroyResult(t, results, "resource group", "rg"); result.Status != want {
+			t.Errorf("with force %t the reused resource group is %s (note: %s), want %s", isForced, result.Status, result.Note, want)
+		}
+		// what migr8 created is deleted either way
+		if result := destroyResult(t, results, "webapp", "web"); result.Status != "DELETED" {
+			t.Errorf("with force %t the webapp is %s (note: %s), want DELETED", isForced, result.Status, result.Note)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package migr8
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ApplyEnvironment deep-merges the overrides of env onto the config that was read from path. The overrides
+// come from the environments section of the config and from a companion file next to it, e.g. stack.staging.json
+// for stack.json, in that order. Without an env only the environments section is dropped
+func ApplyEnvironment(path string, env string, config *InfraConfig) []ValidationError {
+	if env == "" {
+		config.Environments = nil
+		return nil
+	}
+
+	var base map[string]interface{}
+	if ReadConfig(path, &base) != nil {
+		return []ValidationError{{"--env", "failed to read " + path}}
+	}
+
+	// the overlays are keyed by the path that their errors are reported with
+	overlays := []map[string]interface{}{}
+	overlayPaths := []string{}
+	environments, _ := base["environments"].(map[string]interface{})
+	if overlay, ok := environments[env].(map[string]interface{}); ok {
+		overlays = append(overlays, overlay)
+		overlayPaths = append(overlayPaths, "environments."+env)
+	}
+	delete(base, "environments")
+
+	validationErrs := []ValidationError{}
+	companionPath := strings.TrimSuffix(path, filepath.Ext(path)) + "." + env + filepath.Ext(path)
+	if _, statErr := os.Stat(companionPath); statErr == nil {
+		// decode into the typed overrides first, so that type errors are reported with their position
+		var typed Environment
+		var overlay map[string]interface{}
+		if ReadConfig(companionPath, &typed) != nil || ReadConfig(companionPath, &overlay) != nil {
+			return []ValidationError{{"--env", "failed to read " + companionPath}}
+		}
+		for _, unknownErr := range unknownKeys("", overlay, reflect.TypeOf(typed)) {
+			validationErrs = append(validationErrs, ValidationError{filepath.Base(companionPath) + ": " + unknownErr.Path, unknownErr.Message})
+		}
+		overlays = append(overlays, overlay)
+		overlayPaths = append(overlayPaths, filepath.Base(companionPath)+":")
+	}
+
+	if len(overlays) == 0 {
+		known := []string{}
+		for name := range config.Environments {
+			known = append(known, name)
+		}
+		slices.Sort(known)
+		message := fmt.Sprintf("unknown environment %q. There is no environments.%s and no %s", env, env, filepath.Base(companionPath))
+		if len(known) > 0 {
+			message += ". Use " + strings.Join(known, " | ")
+		}
+		return append(validationErrs, ValidationError{"--env", message})
+	}
+
+	merged := interface{}(base)
+	for i, overlay := range overlays {
+		var mergeErrs []ValidationError
+		merged, mergeErrs = mergeValues(overlayPaths[i], merged, overlay)
+		validationErrs = append(validationErrs, mergeErrs...)
+	}
+
+	content, marshalErr := json.Marshal(merged)
+	if marshalErr != nil {
+		return append(validationErrs, ValidationError{"--env", marshalErr.Error()})
+	}
+	environmentConfig := InfraConfig{}
+	unmarshalErr := json.Unmarshal(content, &environmentConfig)
+	if unmarshalErr != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(unmarshalErr, &typeErr) {
+			return append(validationErrs, ValidationError{typeErr.Field, fmt.Sprintf("environment %s sets a %s, expected %s", env, typeErr.Value, typeErr.Type)})
+		}
+		return append(validationErrs, ValidationError{"--env", unmarshalErr.Error()})
+	}
+
+	*config = environmentConfig
+	return validationErrs
+}
+
+// mergeValues deep-merges overlay onto base. Objects are merged key by key, lists of named objects, like apps
+// and settings, are merged by name and anything else is replaced. path is the path of overlay
+func mergeValues(path string, base interface{}, overlay interface{}) (interface{}, []ValidationError) {
+	switch overlayValue := overlay.(type) {
+	case map[string]interface{}:
+		baseValue, ok := base.(map[string]interface{})
+		if !ok {
+			return overlay, nil
+		}
+
+		validationErrs := []ValidationError{}
+		merged := map[string]interface{}{}
+		for key, value := range baseValue {
+			merged[key] = value
+		}
+		for key, value := range overlayValue {
+			var mergeErrs []ValidationError
+			merged[key], mergeErrs = mergeValues(joinPath(path, key), baseValue[key], value)
+			validationErrs = append(validationErrs, mergeErrs...)
+		}
+		return merged, validationErrs
+
+	case []interface{}:
+		baseValue, ok := base.([]interface{})
+		if !ok || !isNamedList(baseValue) {
+			return overlay, nil
+		}
+
+		validationErrs := []ValidationError{}
+		merged := slices.Clone(baseValue)
+		for i, item := range overlayValue {
+			name, hasName := itemName(item)
+			if !hasName {
+				validationErrs = append(validationErrs, ValidationError{fmt.Sprintf("%s[%d].name", path, i), "is required to match the override with an entry of the base config"})
+				continue
+			}
+
+			index := slices.IndexFunc(merged, func(existing interface{}) bool {
+				existingName, _ := itemName(existing)
+				return existingName == name
+			})
+			if index == -1 {
+				merged = append(merged, item)
+				continue
+			}
+
+			var mergeErrs []ValidationError
+			merged[index], mergeErrs = mergeValues(fmt.Sprintf("%s[%d]", path, i), merged[index], item)
+			validationErrs = append(validationErrs, mergeErrs...)
+		}
+		return merged, validationErrs
+	}
+
+	return overlay, nil
+}
+
+// joinPath appends a key to a path. The path of a companion file ends with a colon
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	if strings.HasSuffix(path, ":") {
+		return path + " " + key
+	}
+	return path + "." + key
+}
+
+// isNamedList checks if every item of a list is an object with a name
+func isNamedList(items []interface{}) bool {
+	for _, item := range items {
+		if _, hasName := itemName(item); !hasName {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+func itemName(item interface{}) (string, bool) {
+	object, isObject := item.(map[string]interface{})
+	if !isObject {
+		return "", false
+	}
+	name, hasName := object["name"].(string)
+	return name, hasName && name != ""
+}
@@ -0,0 +1,186 @@
+package migr8
+
+import (
+	"log/slog"
+	"time"
+)
+
+// the phases that events and diagnostics are reported for
+const (
+	PhaseAgent          = "agent"
+	PhaseInfrastructure = "infrastructure"
+	PhasePipeline       = "pipeline"
+	PhaseQueue          = "queue"
+	PhaseSwap           = "swap"
+	PhaseResume         = "resume"
+	PhasePlan           = "plan"
+	PhaseDestroy        = "destroy"
+	PhaseSettings       = "settings"
+	PhaseState          = "state"
+)
+
+type (
+	// Event ~ something that happened while a runner worked. Observers switch on the concrete type, e.g. PhaseStarted
+	Event interface {
+		event()
+	}
+
+	// Observer ~ receives every event of a runner. Notify is called from the workers of a phase, so it has to be
+	// safe for concurrent use, and it should return quickly since the worker waits for it
+	Observer interface {
+		Notify(event Event)
+	}
+
+	// ObserverFunc ~ adapts a plain func to an Observer
+	ObserverFunc func(event Event)
+
+	// PhaseStarted ~ a phase of a run started to work on the given apps
+	PhaseStarted struct {
+		Phase string
+		Apps  []string
+	}
+
+	// PhaseFinished ~ every worker of a phase returned
+	PhaseFinished struct {
+		Phase   string
+		Results []PhaseResult
+	}
+
+	// AppSkipped ~ a phase didn't work on an app, e.g. because an earlier phase failed for it
+	AppSkipped struct {
+		Phase  string
+		App    string
+		Reason string
+	}
+
+	// ResourceCreated ~ a resource was created. ID is the azure resource id or the devops url, if it is known
+	ResourceCreated struct {
+		Phase    string
+		App      string
+		Resource string
+		Name     string
+		ID       string
+	}
+
+	// ResourceSkipped ~ a resource was left as it is, e.g. because it already existed or is still in use
+	ResourceSkipped struct {
+		Phase    string
+		App      string
+		Resource string
+		Name     string
+		Reason   string
+	}
+
+	// ResourceDeleted ~ destroy deleted a resource
+	ResourceDeleted struct {
+		Resource string
+		Name     string
+	}
+
+	// AgentStarted ~ the self hosted agent of an app is up
+	AgentStarted struct {
+		App         string
+		Name        string
+		ContainerID string
+	}
+
+	// PipelineQueued ~ a run of the pipeline of an app was queued, or a run of an interrupted run was reattached.
+	// PipelineID is 0 if the id of the pipeline is unknown
+	PipelineQueued struct {
+		App        string
+		Pipeline   string
+		PipelineID int
+		RunID      int
+		URL        string
+		Reattached bool
+	}
+
+	// PipelineStatusChanged ~ a pipeline run moved to another status. Result is set once the run completed
+	PipelineStatusChanged struct {
+		App        string
+		Pipeline   string
+		PipelineID int
+		RunID      int
+		Status     string
+		Result     string
+	}
+
+	// SlotSwapped ~ a deployment slot of an app passed its health check and was swapped into production
+	SlotSwapped struct {
+		App  string
+		Slot string
+	}
+
+	// RetryScheduled ~ a failed azure or devops call is tried again after Delay
+	RetryScheduled struct {
+		App       string
+		Operation string
+		Class     string
+		Attempt   int
+		Attempts  int
+		Delay     time.Duration
+		Err       error
+	}
+
+	// Diagnostic ~ a message that doesn't change the outcome by itself, e.g. a failed lookup or a missing setting.
+	// Resource and Name are set when the message is about a single resource, e.g. "failed to delete" webapp w1
+	Diagnostic struct {
+		Level    slog.Level
+		Phase    string
+		App      string
+		Resource string
+		Name     string
+		Message  string
+		Err      error
+	}
+
+	// RunFinished ~ a create, deploy, complete or swap run returned
+	RunFinished struct {
+		Run *Run
+	}
+)
+
+func (PhaseStarted) event()          {}
+func (PhaseFinished) event()         {}
+func (AppSkipped) event()            {}
+func (ResourceCreated) event()       {}
+func (ResourceSkipped) event()       {}
+func (ResourceDeleted) event()       {}
+func (AgentStarted) event()          {}
+func (PipelineQueued) event()        {}
+func (PipelineStatusChanged) event() {}
+func (SlotSwapped) event()           {}
+func (RetryScheduled) event()        {}
+func (Diagnostic) event()            {}
+func (RunFinished) event()           {}
+
+// Notify calls the func
+func (f ObserverFunc) Notify(event Event) {
+	f(event)
+}
+
+// ChannelObserver returns an observer that sends every event to events. The runner never closes the channel,
+// since every event is sent before the method that caused it returns, the caller can close it afterwards
+func ChannelObserver(events chan<- Event) Observer {
+	return ObserverFunc(func(event Event) {
+		events <- event
+	})
+}
+
+// Subscribe adds an observer that is notified of every event from now on. Subscribe before a run starts, not
+// while it works
+func (runner *Runner) Subscribe(observer Observer) {
+	runner.observers = append(runner.observers, observer)
+}
+
+// emit notifies every observer of an event
+func (runner *Runner) emit(event Event) {
+	for _, observer := range runner.observers {
+		observer.Notify(event)
+	}
+}
+
+// diagnose emits a diagnostic of a phase of an app
+func (runner *Runner) diagnose(level slog.Level, phase string, app string, message string, err error) {
+	runner.emit(Diagnostic{Level: level, Phase: phase, App: app, Message: message, Err: err})
+}
@@ -0,0 +1,537 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// workers
+func (r *Run) agentWorker(ctx context.Context, appDetails AppDetails) PhaseResult {
+	agentConfig := AgentConfig{
+		Name:      appDetails.Name + "_deployment_agent",
+		DevOpsOrg: r.runner.Config.DevOpsOrg,
+		Pat:       r.runner.Config.Pat,
+		Pool:      r.runner.Config.AgentPool,
+	}
+
+	containerID, agentPoolErr := r.runner.Agents.StartAgent(ctx, agentConfig)
+	if agentPoolErr != nil {
+		r.runner.diagnose(slog.LevelError, PhaseAgent, appDetails.Name, "failed to start the agent", agentPoolErr)
+		return failedResult(agentPoolErr)
+	}
+	r.runner.emit(AgentStarted{App: appDetails.Name, Name: agentConfig.Name, ContainerID: containerID})
+	return succeededResult(containerID)
+}
+
+func (r *Run) infraWorker(ctx context.Context, appDetails AppDetails) PhaseResult {
+	infraCtx, cancel := withTimeout(ctx, r.runner.Options.InfraTimeout)
+	defer cancel()
+
+	var created []string
+	var err error
+	if appDetails.Type == "function" {
+		created, err = r.createFuncApp(infraCtx, appDetails)
+	}
+	if appDetails.Type == "webapp" {
+		created, err = r.createWebapp(infraCtx, appDetails)
+	}
+	if err != nil && errors.Is(infraCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s => %w", r.runner.Options.InfraTimeout, err)
+	}
+	if err != nil {
+		r.runner.diagnose(slog.LevelError, PhaseInfrastructure, appDetails.Name, "failed to create the infrastructure", CommandError(err))
+		return failedResult(err, created...)
+	}
+	return succeededResult(created...)
+}
+
+func (r *Run) pipelineWorker(ctx context.Context, appDetails AppDetails) PhaseResult {
+	if r.Mode == ModeComplete && !r.succeeded(r.Infrastructure, appDetails.Name) {
+		return skippedResult("the infrastructure was not created")
+	}
+
+	isPipelineReused, err := isExisting(ctx, r.runner.retrier(appDetails), "pipeline", func(ctx context.Context, name string) (bool, error) {
+		return r.runner.Pipelines.PipelineExists(ctx, r.runner.Config.DevOpsOrg, appDetails.Pipeline)
+	}, appDetails.Pipeline.Name)
+	if err != nil {
+		r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhasePipeline, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: "failed to look up", Err: CommandError(err)})
+		return failedResult(err)
+	}
+
+	err = retryCall(ctx, r.runner.retrier(appDetails), "create pipeline "+appDetails.Pipeline.Name, func() error {
+		return r.runner.Pipelines.CreatePipeline(ctx, r.runner.Config.DevOpsOrg, appDetails)
+	})
+	if err != nil {
+		r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhasePipeline, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: "failed to create", Err: CommandError(err)})
+		return failedResult(err)
+	}
+
+	id := r.recordPipeline(ctx, appDetails, isPipelineReused)
+	if isPipelineReused {
+		r.runner.emit(ResourceSkipped{Phase: PhasePipeline, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Reason: "already exists"})
+		return succeededResult()
+	}
+
+	url := ""
+	if id != 0 {
+		url = pipelineURL(r.runner.Config.DevOpsOrg, appDetails.Pipeline.Project, id)
+	}
+	r.runner.emit(ResourceCreated{Phase: PhasePipeline, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, ID: url})
+	if id == 0 {
+		return succeededResult()
+	}
+	return succeededResult(url)
+}
+
+func (r *Run) queuePipelineWorker(ctx context.Context, appDetails AppDetails) PhaseResult {
+	isAgentUp := r.succeeded(r.Agents, appDetails.Name)
+	isPipelineUp := r.succeeded(r.Pipelines, appDetails.Name)
+
+	if !isAgentUp && !isPipelineUp {
+		return skippedResult("neither the agent nor the pipeline was created")
+	}
+	if !isAgentUp {
+		return skippedResult("the agent was not started")
+	}
+	if !isPipelineUp {
+		return skippedResult("the pipeline was not created")
+	}
+
+	parameters := r.getPipelineParams(appDetails)
+	retry := r.runner.retrier(appDetails)
+
+	// the timeout covers the whole run, from queueing it until it completes
+	runCtx, cancel := withTimeout(ctx, r.runner.Options.PipelineTimeout)
+	defer cancel()
+
+	// a run that is still in flight since an interrupted run is polled instead of queued again
+	pipelineRun, isReattached := r.Resumed[appDetails.Name]
+	if !isReattached {
+		// queueing isn't retried. A queue call that failed, e.g. on a timeout, may still have queued a run, and a
+		// retry would queue a second one
+		var err error
+		pipelineRun, err = r.runner.Pipelines.QueuePipeline(runCtx, r.runner.Config.DevOpsOrg, appDetails, parameters)
+		if err != nil {
+			r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseQueue, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: "failed to queue", Err: CommandError(err)})
+			return failedResult(err)
+		}
+		r.runner.state.updateApp(appDetails.Name, func(app *AppState) {
+			queuedAt := time.Now().UTC()
+			app.RunID = pipelineRun.ID
+			app.RunURL = pipelineRun.URL
+			app.RunResult = ""
+			app.QueuedAt = &queuedAt
+			app.FinishedAt = nil
+		})
+	}
+	pipelineID := r.pipelineID(appDetails)
+	r.runner.emit(PipelineQueued{App: appDetails.Name, Pipeline: appDetails.Pipeline.Name, PipelineID: pipelineID, RunID: pipelineRun.ID, URL: pipelineRun.URL, Reattached: isReattached})
+
+	// start pipeline polling only if there was no error queueing the pipeline
+	var pipelineStatus PipelineRun
+	lastStatus := ""
+	for {
+		// a failed status check is retried, so that a single error doesn't stop monitoring a run that is still in flight
+		pipeline, err := withRetry(runCtx, retry, "get pipeline status "+appDetails.Pipeline.Name, func() (PipelineRun, error) {
+			return r.runner.Pipelines.GetPipelineRun(runCtx, r.runner.Config.DevOpsOrg, appDetails.Pipeline.Project, pipelineRun.ID)
+		})
+		if err == nil && pipeline.Status == "completed" {
+			pipelineStatus = pipeline
+			break
+		}
+		if err == nil && pipeline.Status != lastStatus {
+			lastStatus = pipeline.Status
+			r.runner.emit(PipelineStatusChanged{App: appDetails.Name, Pipeline: appDetails.Pipeline.Name, PipelineID: pipelineID, RunID: pipelineRun.ID, Status: pipeline.Status})
+		}
+		if err != nil && runCtx.Err() == nil {
+			stopErr := fmt.Errorf("stopped monitoring run #%d after a %s error => %w", pipelineRun.ID, classifyError(err), CommandError(err))
+			r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseQueue, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: fmt.Sprintf("stopped monitoring run #%d", pipelineRun.ID), Err: CommandError(err)})
+			return failedResult(stopErr, pipelineRun.URL)
+		}
+		if err != nil || sleepContext(runCtx, r.runner.Options.PollInterval) != nil {
+			return failedResult(r.stopPipelineRun(appDetails, pipelineRun, context.Cause(runCtx)), pipelineRun.URL)
+		}
+	}
+
+	// the pipeline completed, record its result
+	r.runner.state.updateApp(appDetails.Name, func(app *AppState) {
+		finishedAt := time.Now().UTC()
+		app.RunResult = pipelineStatus.Result
+		app.FinishedAt = &finishedAt
+	})
+	r.runner.emit(PipelineStatusChanged{App: appDetails.Name, Pipeline: appDetails.Pipeline.Name, PipelineID: pipelineID, RunID: pipelineRun.ID, Status: pipelineStatus.Status, Result: pipelineStatus.Result})
+
+	if pipelineStatus.Result != "succeeded" {
+		return failedResult(fmt.Errorf("run #%d completed with result %s", pipelineRun.ID, pipelineStatus.Result), pipelineRun.URL)
+	}
+	return succeededResult(pipelineRun.URL)
+}
+
+// stopPipelineRun cancels a run in azure devops once it timed out, migr8 was interrupted or FailFast stopped the
+// run, so that it doesn't keep running on an agent that is about to be removed. It returns why the run was stopped
+func (r *Run) stopPipelineRun(appDetails AppDetails, pipelineRun PipelineRun, reason error) error {
+	stopErr := fmt.Errorf("run #%d was interrupted", pipelineRun.ID)
+	level := slog.LevelWarn
+	var failFastErr failFastError
+	if errors.As(reason, &failFastErr) {
+		stopErr = fmt.Errorf("run #%d was %w", pipelineRun.ID, failFastErr)
+	}
+	if errors.Is(reason, context.DeadlineExceeded) {
+		stopErr = fmt.Errorf("run #%d timed out after %s", pipelineRun.ID, r.runner.Options.PipelineTimeout)
+		level = slog.LevelError
+	}
+	r.runner.emit(Diagnostic{Level: level, Phase: PhaseQueue, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: fmt.Sprintf("cancelling run #%d", pipelineRun.ID), Err: stopErr})
+
+	// the run context is already done, so the cancellation gets a deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cancelErr := r.runner.Pipelines.CancelPipelineRun(ctx, r.runner.Config.DevOpsOrg, appDetails.Pipeline.Project, pipelineRun.ID)
+	if cancelErr != nil {
+		r.runner.diagnose(slog.LevelError, PhaseQueue, appDetails.Name, fmt.Sprintf("failed to cancel run #%d. Cancel it in the devops portal", pipelineRun.ID), CommandError(cancelErr))
+		return fmt.Errorf("%w and could not be cancelled => %w", stopErr, CommandError(cancelErr))
+	}
+
+	r.runner.state.updateApp(appDetails.Name, func(app *AppState) {
+		finishedAt := time.Now().UTC()
+		app.RunResult = "canceled"
+		app.FinishedAt = &finishedAt
+	})
+	r.runner.emit(PipelineStatusChanged{App: appDetails.Name, Pipeline: appDetails.Pipeline.Name, PipelineID: r.pipelineID(appDetails), RunID: pipelineRun.ID, Status: "completed", Result: "canceled"})
+	return fmt.Errorf("%w and was cancelled", stopErr)
+}
+
+func (r *Run) swapWorker(ctx context.Context, appDetails AppDetails) PhaseResult {
+	if r.IsDeploy() && !r.succeeded(r.Queues, appDetails.Name) {
+		return skippedResult("the pipeline run did not succeed")
+	}
+
+	slot := appDetails.DeploySlot()
+	slotName := appDetails.Name + "/" + slot.Name
+	r.runner.emit(Diagnostic{Level: slog.LevelInfo, Phase: PhaseSwap, App: appDetails.Name, Resource: "deployment slot", Name: slotName, Message: "checking the health of"})
+
+	healthErr := r.awaitHealthy(ctx, appDetails, *slot)
+	if healthErr != nil {
+		r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseSwap, App: appDetails.Name, Resource: "deployment slot", Name: slotName, Message: "not swapping the unhealthy", Err: healthErr})
+		return failedResult(healthErr)
+	}
+
+	swapErr := retryCall(ctx, r.runner.retrier(appDetails), "swap deployment slot "+slotName, func() error {
+		return r.runner.Provisioner.SwapSlot(ctx, appDetails, slot.Name)
+	})
+	if swapErr != nil {
+		r.runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhaseSwap, App: appDetails.Name, Resource: "deployment slot", Name: slotName, Message: "failed to swap", Err: CommandError(swapErr)})
+		return failedResult(swapErr)
+	}
+
+	r.runner.emit(SlotSwapped{App: appDetails.Name, Slot: slot.Name})
+	return succeededResult()
+}
+
+// awaitHealthy checks the health of a slot every poll interval until it answers with a 2xx status or its health
+// check timeout expires
+func (r *Run) awaitHealthy(ctx context.Context, appDetails AppDetails, slot Slot) error {
+	healthCtx, cancel := context.WithTimeout(ctx, slot.healthCheckTimeout())
+	defer cancel()
+
+	for {
+		healthErr := r.runner.Provisioner.CheckSlotHealth(healthCtx, appDetails, slot)
+		if healthErr == nil {
+			return nil
+		}
+		if sleepContext(healthCtx, r.runner.Options.PollInterval) == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped waiting for slot %s to become healthy => %w", slot.Name, context.Cause(ctx))
+		}
+		return fmt.Errorf("slot %s was not healthy after %s => %w", slot.Name, slot.healthCheckTimeout(), CommandError(healthErr))
+	}
+}
+
+// infrastructure wrappers
+// createFuncApp creates the resource group, storage account and function app of an app. It returns the azure
+// resource ids of everything it created, even if a later step failed
+func (r *Run) createFuncApp(ctx context.Context, funcApp AppDetails) ([]string, error) {
+
+	r.runner.diagnose(slog.LevelInfo, PhaseInfrastructure, funcApp.Name, "creating azure function app", nil)
+	created := []string{}
+	retry := r.runner.retrier(funcApp)
+
+	isRgReused, rgError := isExisting(ctx, retry, "resource group", r.runner.Provisioner.ResourceGroupExists, funcApp.ResourceGroup)
+	if rgError != nil {
+		return created, fmt.Errorf("resource group %s => %w", funcApp.ResourceGroup, rgError)
+	}
+	rgError = retryCall(ctx, retry, "create resource group "+funcApp.ResourceGroup, func() error { return r.runner.Provisioner.CreateResourceGroup(ctx, funcApp) })
+	if rgError != nil {
+		return created, fmt.Errorf("resource group %s => %w", funcApp.ResourceGroup, rgError)
+	}
+	created = r.trackResource(created, funcApp, "resource group", funcApp.ResourceGroup, isRgReused)
+
+	// make sure that the storage account does not exist. This is important to avoid overwriting function logs etc.
+	isSaReused, saError := isExisting(ctx, retry, "storage account", r.runner.Provisioner.StorageAccountExists, funcApp.StorageAccount)
+	if saError != nil {
+		return created, fmt.Errorf("storage account %s => %w", funcApp.StorageAccount, saError)
+	}
+	saError = retryCall(ctx, retry, "create storage account "+funcApp.StorageAccount, func() error { return r.runner.Provisioner.CreateStorageAccount(ctx, funcApp) })
+	if saError != nil {
+		return created, fmt.Errorf("storage account %s => %w", funcApp.StorageAccount, saError)
+	}
+	created = r.trackResource(created, funcApp, "storage account", funcApp.StorageAccount, isSaReused)
+
+	// make sure the functionapp does not exist. This is important to avoid overwriting function during deployment
+	isFaReused, faError := isExisting(ctx, retry, "function app", r.runner.Provisioner.FunctionAppExists, funcApp.Name)
+	if faError != nil {
+		return created, fmt.Errorf("function app %s => %w", funcApp.Name, faError)
+	}
+	faError = retryCall(ctx, retry, "create function app "+funcApp.Name, func() error { return r.runner.Provisioner.CreateFunctionApp(ctx, funcApp) })
+	if faError != nil {
+		return created, fmt.Errorf("function app %s => %w", funcApp.Name, faError)
+	}
+	created = r.trackResource(created, funcApp, "function app", funcApp.Name, isFaReused)
+
+	settingsErr := r.applySettings(ctx, funcApp, "")
+	if settingsErr != nil {
+		return created, settingsErr
+	}
+
+	return r.createSlots(ctx, funcApp, created)
+}
+
+// createWebapp creates the resource group, app service plan and webapp of an app. It returns the azure resource
+// ids of everything it created, even if a later step failed
+func (r *Run) createWebapp(ctx context.Context, webapp AppDetails) ([]string, error) {
+
+	r.runner.diagnose(slog.LevelInfo, PhaseInfrastructure, webapp.Name, "creating azure webapp", nil)
+	created := []string{}
+	retry := r.runner.retrier(webapp)
+
+	// make sure the resource group for the webapp exists
+	isRgReused, rgError := isExisting(ctx, retry, "resource group", r.runner.Provisioner.ResourceGroupExists, webapp.ResourceGroup)
+	if rgError != nil {
+		return created, fmt.Errorf("resource group %s => %w", webapp.ResourceGroup, rgError)
+	}
+	rgError = retryCall(ctx, retry, "create resource group "+webapp.ResourceGroup, func() error { return r.runner.Provisioner.CreateResourceGroup(ctx, webapp) })
+	if rgError != nil {
+		return created, fmt.Errorf("resource group %s => %w", webapp.ResourceGroup, rgError)
+	}
+	created = r.trackResource(created, webapp, "resource group", webapp.ResourceGroup, isRgReused)
+
+	// make sure the app service plan exists
+	isAspReused, aseError := isExisting(ctx, retry, "app service plan", r.runner.Provisioner.AppServicePlanExists, webapp.AppServicePlan)
+	if aseError != nil {
+		return created, fmt.Errorf("app service plan %s => %w", webapp.AppServicePlan, aseError)
+	}
+	aseError = retryCall(ctx, retry, "create app service plan "+webapp.AppServicePlan, func() error { return r.runner.Provisioner.CreateAppServicePlan(ctx, webapp) })
+	if aseError != nil {
+		return created, fmt.Errorf("app service plan %s => %w", webapp.AppServicePlan, aseError)
+	}
+	created = r.trackResource(created, webapp, "app service plan", webapp.AppServicePlan, isAspReused)
+
+	// create the webapp
+	isWaReused, waError := isExisting(ctx, retry, "webapp", r.runner.Provisioner.WebAppExists, webapp.Name)
+	if waError != nil {
+		return created, fmt.Errorf("webapp %s => %w", webapp.Name, waError)
+	}
+	waError = retryCall(ctx, retry, "create webapp "+webapp.Name, func() error { return r.runner.Provisioner.CreateWebApp(ctx, webapp) })
+	if waError != nil {
+		return created, fmt.Errorf("webapp %s => %w", webapp.Name, waError)
+	}
+	created = r.trackResource(created, webapp, "webapp", webapp.Name, isWaReused)
+
+	settingsErr := r.applySettings(ctx, webapp, "")
+	if settingsErr != nil {
+		return created, settingsErr
+	}
+
+	return r.createSlots(ctx, webapp, created)
+}
+
+// createSlots creates the deployment slots of an app once the app exists. Every slot gets the settings of the
+// app with its own settings on top, see SlotSettings
+func (r *Run) createSlots(ctx context.Context, app AppDetails, created []string) ([]string, error) {
+	retry := r.runner.retrier(app)
+
+	for _, slot := range app.Slots {
+		slotName := slot.Name
+		isSlotReused, slotErr := isExisting(ctx, retry, "deployment slot", func(ctx context.Context, name string) (bool, error) {
+			return r.runner.Provisioner.SlotExists(ctx, app, name)
+		}, slotName)
+		if slotErr != nil {
+			return created, fmt.Errorf("deployment slot %s => %w", slotName, slotErr)
+		}
+		slotErr = retryCall(ctx, retry, "create deployment slot "+app.Name+"/"+slotName, func() error { return r.runner.Provisioner.CreateSlot(ctx, app, slotName) })
+		if slotErr != nil {
+			return created, fmt.Errorf("deployment slot %s => %w", slotName, slotErr)
+		}
+		created = r.trackResource(created, app, "deployment slot", app.Name+"/"+slotName, isSlotReused)
+
+		settingsErr := r.applySettings(ctx, app, slotName)
+		if settingsErr != nil {
+			return created, fmt.Errorf("deployment slot %s => %w", slotName, settingsErr)
+		}
+	}
+
+	return created, nil
+}
+
+// applySettings sets the settings of an app, or of one of its slots, as app settings. Webapps that pass their
+// settings as pipeline parameters are left alone
+func (r *Run) applySettings(ctx context.Context, app AppDetails, slot string) error {
+	if app.SettingsAsParameters() {
+		return nil
+	}
+
+	// if the app has no environment variables just report it, once for the app and not for every slot
+	if len(app.SlotSettings(slot)) == 0 {
+		if slot == "" {
+			r.runner.diagnose(slog.LevelWarn, PhaseInfrastructure, app.Name, "no app settings to update. Skipping settings configuration", nil)
+		}
+		return nil
+	}
+
+	// the identity has to be able to read the secrets before the references are set
+	if accessErr := r.runner.grantKeyVaultAccess(ctx, PhaseInfrastructure, app, slot); accessErr != nil {
+		return accessErr
+	}
+
+	target := strings.TrimSuffix(app.Name+"/"+slot, "/")
+	settingsErr := retryCall(ctx, r.runner.retrier(app), "set app settings "+target, func() error { return r.runner.Provisioner.SetAppSettings(ctx, app, slot, app.SlotSettings(slot)) })
+	if settingsErr != nil {
+		return fmt.Errorf("app settings => %w", settingsErr)
+	}
+	return nil
+}
+
+// utility functions
+
+// resume compares every app with the last pipeline run recorded in the state. Apps whose last run succeeded
+// are skipped and runs that are still in flight are reattached, everything else is deployed again
+func (r *Run) resume(ctx context.Context) {
+	r.runner.emit(Diagnostic{Level: slog.LevelInfo, Phase: PhaseResume, Resource: "state file", Name: r.runner.Options.StatePath, Message: "resuming from"})
+
+	for _, app := range r.Apps {
+		appState, ok := r.runner.state.app(app.Name)
+		// a run of a pipeline that was renamed since doesn't say anything about the current pipeline
+		if !ok || appState.RunID == 0 || (appState.PipelineName != "" && appState.PipelineName != app.Pipeline.Name) {
+			continue
+		}
+
+		result := appState.RunResult
+		if result == "" {
+			pipelineRun, err := withRetry(ctx, r.runner.retrier(app), "get pipeline status "+app.Pipeline.Name, func() (PipelineRun, error) {
+				return r.runner.Pipelines.GetPipelineRun(ctx, r.runner.Config.DevOpsOrg, app.Pipeline.Project, appState.RunID)
+			})
+			if err != nil {
+				r.runner.diagnose(slog.LevelWarn, PhaseResume, app.Name, fmt.Sprintf("failed to look up run #%d. Queueing a new run", appState.RunID), CommandError(err))
+				continue
+			}
+			if pipelineRun.Status != "completed" {
+				r.runner.diagnose(slog.LevelInfo, PhaseResume, app.Name, fmt.Sprintf("run #%d is still %s", appState.RunID, pipelineRun.Status), nil)
+				r.Resumed[app.Name] = pipelineRun
+				continue
+			}
+
+			// the run completed while migr8 wasn't polling it
+			result = pipelineRun.Result
+			r.runner.state.updateApp(app.Name, func(app *AppState) {
+				finishedAt := time.Now().UTC()
+				app.RunResult = pipelineRun.Result
+				app.FinishedAt = &finishedAt
+			})
+		}
+
+		if result == "succeeded" {
+			r.Skipped[app.Name] = fmt.Sprintf("run #%d succeeded", appState.RunID)
+		}
+	}
+}
+
+// isExisting looks up if a resource exists before it gets created, to tell created and reused resources apart.
+// The lookup is retried like the create. A lookup that keeps failing is returned instead of guessing, because a
+// wrong guess either claims a resource that migr8 didn't create or loses track of one that it did
+func isExisting(ctx context.Context, retry retrier, resource string, exists func(context.Context, string) (bool, error), name string) (bool, error) {
+	isFound, err := withRetry(ctx, retry, "look up "+resource+" "+name, func() (bool, error) { return exists(ctx, name) })
+	if err != nil {
+		return false, fmt.Errorf("failed to look up => %w", err)
+	}
+	return isFound, nil
+}
+
+// recordPipeline stores the pipeline of an app and its id in the state. It returns the id, or 0 if it is unknown
+func (r *Run) recordPipeline(ctx context.Context, appDetails AppDetails, isReused bool) int {
+	r.runner.state.recordResource(appDetails.Name, "pipeline", appDetails.Pipeline.Name, isReused)
+
+	id, idErr := r.runner.Pipelines.PipelineID(ctx, r.runner.Config.DevOpsOrg, appDetails.Pipeline)
+	if idErr != nil {
+		r.runner.emit(Diagnostic{Level: slog.LevelWarn, Phase: PhasePipeline, App: appDetails.Name, Resource: "pipeline", Name: appDetails.Pipeline.Name, Message: "failed to retrieve the id", Err: CommandError(idErr)})
+		return 0
+	}
+	r.runner.state.updateApp(appDetails.Name, func(app *AppState) {
+		app.PipelineName = appDetails.Pipeline.Name
+		app.PipelineID = id
+	})
+	return id
+}
+
+// pipelineID returns the id of the pipeline of an app that the state knows of, or 0
+func (r *Run) pipelineID(appDetails AppDetails) int {
+	appState, ok := r.runner.state.app(appDetails.Name)
+	if !ok || appState.PipelineName != appDetails.Pipeline.Name {
+		return 0
+	}
+	return appState.PipelineID
+}
+
+// trackResource records a resource of an app in the state and adds its azure resource id to created, unless
+// the resource was reused
+func (r *Run) trackResource(created []string, app AppDetails, resource string, name string, isReused bool) []string {
+	r.runner.state.recordResource(app.Name, resource, name, isReused)
+	if isReused {
+		r.runner.emit(ResourceSkipped{Phase: PhaseInfrastructure, App: app.Name, Resource: resource, Name: name, Reason: "already exists"})
+		return created
+	}
+
+	id := r.runner.azureResourceID(resource, app.ResourceGroup, name)
+	r.runner.emit(ResourceCreated{Phase: PhaseInfrastructure, App: app.Name, Resource: resource, Name: name, ID: id})
+	return append(created, id)
+}
+
+func (r *Run) getPipelineParams(appDetails AppDetails) []string {
+	parameters := []string{
+		"azureSubscription=" + r.runner.Options.SubscriptionID,
+		"appName=" + appDetails.Name,
+		"agentPool=" + r.runner.Config.AgentPool,
+		"agent=" + appDetails.Name + "_deployment_agent",
+	}
+
+	if appDetails.Type == "function" {
+		parameters = append(parameters, "resourceGroup="+appDetails.ResourceGroup)
+	}
+
+	// the pipeline deploys to the slot, which the swap phase swaps into production afterwards
+	if slot := appDetails.DeploySlot(); slot != nil {
+		parameters = append(parameters, "slot="+slot.Name)
+	}
+
+	// only webapps that opted into the pipeline parameters get their settings this way, every other app has
+	// them set as app settings while its infrastructure is created
+	if appDetails.SettingsAsParameters() {
+		for _, env := range appDetails.Settings {
+			specialChars, _ := regexp.Compile(`[!@#\$%\^&\*\(\)_\+\=\[\]\{\};'"\\|,<>?~]`)
+			param := env.Name + "=" + env.Value
+			if specialChars.MatchString(env.Value) {
+				param = fmt.Sprintf("%s=\"%s\"", env.Name, env.Value)
+			}
+			parameters = append(parameters, param)
+		}
+	}
+
+	return parameters
+}
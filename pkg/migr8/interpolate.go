@@ -0,0 +1,118 @@
+package migr8
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// placeholder matches ${VAR}, ${VAR:-default} and $${, the escape of a literal ${. Any other $ is left alone, so
+// values like passwords keep their $$
+var placeholder = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// InterpolateConfig replaces the placeholders of every string field of a config with the value of the variable
+// they name. Variables come from the KEY=VALUE pairs first and from the environment second. Every placeholder
+// without a value and without a default is returned as an error
+func InterpolateConfig(config *InfraConfig, pairs []string) []ValidationError {
+	lookup, pairErr := variables(pairs)
+	if pairErr != nil {
+		return []ValidationError{*pairErr}
+	}
+
+	validationErrs := []ValidationError{}
+	interpolateValue("", reflect.ValueOf(config).Elem(), lookup, &validationErrs)
+	return validationErrs
+}
+
+// variables returns the lookup of the placeholder variables, which prefers the KEY=VALUE pairs over the environment
+func variables(pairs []string) (func(string) (string, bool), *ValidationError) {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		key, value, isPair := strings.Cut(pair, "=")
+		if !isPair || strings.TrimSpace(key) == "" {
+			return nil, &ValidationError{"--var", fmt.Sprintf("%q is not in the form KEY=VALUE", pair)}
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+
+	return func(name string) (string, bool) {
+		if value, ok := vars[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}, nil
+}
+
+// describeMissingVariable explains how to set a variable that a placeholder names
+func describeMissingVariable(name string) string {
+	return fmt.Sprintf("variable %s is not set. Set it in the environment, with --var %s=VALUE or use ${%s:-default}", name, name, name)
+}
+
+// interpolateValue walks a value along its json paths and interpolates every settable string
+func interpolateValue(path string, value reflect.Value, lookup func(string) (string, bool), validationErrs *[]ValidationError) {
+	switch value.Kind() {
+	case reflect.String:
+		interpolated, missing := interpolate(value.String(), lookup)
+		for _, name := range missing {
+			*validationErrs = append(*validationErrs, ValidationError{path, describeMissingVariable(name)})
+		}
+		value.SetString(interpolated)
+
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			interpolateValue(strings.TrimPrefix(path+"."+name, "."), value.Field(i), lookup, validationErrs)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			interpolateValue(fmt.Sprintf("%s[%d]", path, i), value.Index(i), lookup, validationErrs)
+		}
+
+	case reflect.Map:
+		// map values aren't addressable, so they are interpolated on a copy and stored back
+		for _, key := range value.MapKeys() {
+			item := reflect.New(value.Type().Elem()).Elem()
+			item.Set(value.MapIndex(key))
+			interpolateValue(fmt.Sprintf("%s.%v", path, key), item, lookup, validationErrs)
+			value.SetMapIndex(key, item)
+		}
+
+	case reflect.Pointer:
+		if !value.IsNil() {
+			interpolateValue(path, value.Elem(), lookup, validationErrs)
+		}
+	}
+}
+
+// interpolate replaces the placeholders of text and returns the names of the variables that have no value
+func interpolate(text string, lookup func(string) (string, bool)) (string, []string) {
+	missing := []string{}
+
+	interpolated := placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		groups := placeholder.FindStringSubmatch(match)
+		name, hasDefault, fallback := groups[1], groups[2] != "", groups[3]
+
+		value, ok := lookup(name)
+		// like in a shell, the default also replaces an empty value
+		if hasDefault && value == "" {
+			return fallback
+		}
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+
+	return interpolated, missing
+}
@@ -0,0 +1,34 @@
+package migr8
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInterpolateOnlyUnescapesPlaceholders(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "ENV" {
+			return "prod", true
+		}
+		return "", false
+	}
+
+	cases := map[string]string{
+		"api-${ENV}":          "api-prod",
+		"${REGION:-west}":     "west",
+		"$${ENV}":             "${ENV}",
+		"pa$$word":            "pa$$word",
+		"$$":                  "$$",
+		"cost $5 and $${ENV}": "cost $5 and ${ENV}",
+	}
+	for text, want := range cases {
+		interpolated, missing := interpolate(text, lookup)
+		if interpolated != want || len(missing) > 0 {
+			t.Errorf("interpolate(%q) = %q, %v, want %q", text, interpolated, missing, want)
+		}
+	}
+
+	if _, missing := interpolate("${MISSING}", lookup); !slices.Equal(missing, []string{"MISSING"}) {
+		t.Errorf("the missing variables are %v, want [MISSING]", missing)
+	}
+}
@@ -0,0 +1,118 @@
+package migr8
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// keyVaultSecretsRole is the built-in role that lets an identity read the secrets of a Key Vault that uses Azure RBAC
+const keyVaultSecretsRole = "Key Vault Secrets User"
+
+// keyVaultSecretURI matches the vault of a SecretUri reference, e.g. https://my-vault.vault.azure.net/secrets/db
+var keyVaultSecretURI = regexp.MustCompile(`(?i)^https://([^./]+)\.vault\.`)
+
+// KeyVaults returns the Key Vaults that the settings of the app and of its slots reference, without duplicates.
+// They are read from the values, so that the references that were copied from another app, or written inline,
+// count too. ResolveSettings has to run first
+func (app AppDetails) KeyVaults() []string {
+	vaults := []string{}
+	settings := slices.Clone(app.Settings)
+	for _, slot := range app.Slots {
+		settings = append(settings, slot.Settings...)
+	}
+	for _, setting := range settings {
+		if vault := referencedKeyVault(setting.Value); vault != "" && !slices.Contains(vaults, vault) {
+			vaults = append(vaults, vault)
+		}
+	}
+	return vaults
+}
+
+// referencedKeyVault returns the vault of a @Microsoft.KeyVault(...) value, in either the VaultName or the
+// SecretUri form, or "" if the value isn't a Key Vault reference
+func referencedKeyVault(value string) string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "@Microsoft.KeyVault(") || !strings.HasSuffix(value, ")") {
+		return ""
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "@Microsoft.KeyVault("), ")"), ";") {
+		key, property, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch {
+		case strings.EqualFold(key, "VaultName"):
+			return property
+		case strings.EqualFold(key, "SecretUri"):
+			if match := keyVaultSecretURI.FindStringSubmatch(property); match != nil {
+				return match[1]
+			}
+		}
+	}
+	return ""
+}
+
+// grantKeyVaultAccess makes sure that an app, or one of its slots, can resolve the Key Vault references of its
+// settings. It turns on the system assigned identity of the app or slot and lets it read the secrets of every vault
+func (runner *Runner) grantKeyVaultAccess(ctx context.Context, phase string, app AppDetails, slot string) error {
+	vaults := app.KeyVaults()
+	if len(vaults) == 0 || app.SettingsAsParameters() {
+		return nil
+	}
+
+	retry := runner.retrier(app)
+	target := strings.TrimSuffix(app.Name+"/"+slot, "/")
+
+	principalID, identityErr := withRetry(ctx, retry, "assign the managed identity of "+target, func() (string, error) {
+		return runner.Provisioner.AssignIdentity(ctx, app, slot)
+	})
+	if identityErr != nil {
+		return fmt.Errorf("managed identity => %w", identityErr)
+	}
+
+	for _, vault := range vaults {
+		grantErr := retryCall(ctx, retry, "grant "+target+" access to key vault "+vault, func() error {
+			return runner.Provisioner.GrantKeyVaultAccess(ctx, vault, principalID)
+		})
+		if grantErr != nil {
+			return fmt.Errorf("key vault %s => %w", vault, grantErr)
+		}
+		runner.diagnose(slog.LevelInfo, phase, app.Name, fmt.Sprintf("%s can read the secrets of key vault %s", target, vault), nil)
+	}
+	return nil
+}
+
+// assignIdentity turns on the system assigned identity of an app or slot and returns its principal id. Assigning
+// it again returns the same identity
+func assignIdentity(ctx context.Context, app AppDetails, slot string) (string, error) {
+	args := []string{azAppKind(app), "identity", "assign", "--name", app.Name, "--resource-group", app.ResourceGroup, "--query", "principalId"}
+	if slot != "" {
+		args = append(args, "--slot", slot)
+	}
+	return azQuery[string](ctx, args...)
+}
+
+// grantKeyVaultAccess lets an identity read the secrets of a Key Vault, with a role assignment when the vault uses
+// Azure RBAC and with an access policy otherwise
+func grantKeyVaultAccess(ctx context.Context, vault string, principalID string) error {
+	type keyVault struct {
+		ID     string `json:"id"`
+		IsRBAC bool   `json:"isRbac"`
+	}
+	details, err := azQuery[keyVault](ctx, "keyvault", "show", "--name", vault, "--query", "{id:id, isRbac:properties.enableRbacAuthorization}")
+	if err != nil {
+		return err
+	}
+
+	if !details.IsRBAC {
+		return azRun(ctx, "keyvault", "set-policy", "--name", vault, "--object-id", principalID, "--secret-permissions", "get")
+	}
+	roleErr := azRun(ctx, "role", "assignment", "create", "--assignee-object-id", principalID, "--assignee-principal-type", "ServicePrincipal",
+		"--role", keyVaultSecretsRole, "--scope", details.ID)
+	// the identity of an app that existed before keeps its role assignment
+	if roleErr != nil && strings.Contains(roleErr.Error(), "RoleAssignmentExists") {
+		return nil
+	}
+	return roleErr
+}
@@ -0,0 +1,123 @@
+package migr8
+
+import (
+	"context"
+	"log/slog"
+)
+
+// phaseMessages are logged when a phase of a run starts
+var phaseMessages = map[string]string{
+	PhaseAgent:          "starting all agents",
+	PhaseInfrastructure: "creating all infrastructure",
+	PhasePipeline:       "creating all pipelines",
+	PhaseQueue:          "queueing all pipelines",
+	PhaseSwap:           "swapping all deploy slots",
+}
+
+// logObserver ~ writes every event of a runner as a record of a slog logger
+type logObserver struct {
+	logger *slog.Logger
+}
+
+// NewLogObserver returns an observer that logs every event to logger. The messages don't change between runs and
+// everything else is a field, e.g. app, phase, resource, name, pipeline_id, run_id and error. Resource events
+// carry an action field (created, kept, deleted or swapped) and completed pipeline runs a result field
+func NewLogObserver(logger *slog.Logger) Observer {
+	return logObserver{logger: logger}
+}
+
+func (observer logObserver) Notify(event Event) {
+	switch e := event.(type) {
+	case PhaseStarted:
+		observer.log(slog.LevelInfo, phaseMessages[e.Phase], slog.String("phase", e.Phase), slog.Int("apps", len(e.Apps)))
+
+	case PhaseFinished:
+		counts := map[string]int{}
+		for _, result := range e.Results {
+			counts[result.Status]++
+		}
+		observer.log(slog.LevelDebug, "phase finished", slog.String("phase", e.Phase),
+			slog.Int("succeeded", counts[StatusSucceeded]), slog.Int("failed", counts[StatusFailed]), slog.Int("skipped", counts[StatusSkipped]))
+
+	case AppSkipped:
+		observer.log(slog.LevelWarn, "skipped", slog.String("phase", e.Phase), slog.String("app", e.App), slog.String("reason", e.Reason))
+
+	case ResourceCreated:
+		attrs := []slog.Attr{slog.String("phase", e.Phase), slog.String("app", e.App), slog.String("resource", e.Resource), slog.String("name", e.Name), slog.String("action", "created")}
+		if e.ID != "" {
+			attrs = append(attrs, slog.String("id", e.ID))
+		}
+		observer.log(slog.LevelInfo, "created", attrs...)
+
+	case ResourceSkipped:
+		observer.log(slog.LevelInfo, "kept", slog.String("phase", e.Phase), slog.String("app", e.App), slog.String("resource", e.Resource),
+			slog.String("name", e.Name), slog.String("action", "kept"), slog.String("reason", e.Reason))
+
+	case ResourceDeleted:
+		observer.log(slog.LevelInfo, "deleted", slog.String("phase", PhaseDestroy), slog.String("resource", e.Resource), slog.String("name", e.Name), slog.String("action", "deleted"))
+
+	case AgentStarted:
+		observer.log(slog.LevelInfo, "started", slog.String("phase", PhaseAgent), slog.String("app", e.App), slog.String("resource", "agent"),
+			slog.String("name", e.Name), slog.String("container_id", e.ContainerID))
+
+	case PipelineQueued:
+		message := "queued a run"
+		if e.Reattached {
+			message = "reattached to a run"
+		}
+		observer.log(slog.LevelInfo, message, append(pipelineAttrs(e.App, e.Pipeline, e.PipelineID, e.RunID), slog.String("url", e.URL))...)
+
+	case PipelineStatusChanged:
+		attrs := pipelineAttrs(e.App, e.Pipeline, e.PipelineID, e.RunID)
+		if e.Status != "completed" {
+			observer.log(slog.LevelInfo, "waiting for the run", append(attrs, slog.String("status", e.Status))...)
+			return
+		}
+
+		level := slog.LevelError
+		switch e.Result {
+		case "succeeded":
+			level = slog.LevelInfo
+		case "canceled":
+			level = slog.LevelWarn
+		}
+		observer.log(level, "completed a run", append(attrs, slog.String("result", e.Result))...)
+
+	case SlotSwapped:
+		observer.log(slog.LevelInfo, "swapped into production", slog.String("phase", PhaseSwap), slog.String("app", e.App), slog.String("resource", "deployment slot"),
+			slog.String("name", e.App+"/"+e.Slot), slog.String("action", "swapped"))
+
+	case RetryScheduled:
+		observer.log(slog.LevelWarn, "retrying", slog.String("app", e.App), slog.String("operation", e.Operation), slog.String("class", e.Class),
+			slog.Int("attempt", e.Attempt), slog.Int("attempts", e.Attempts), slog.Duration("delay", e.Delay), slog.Any("error", e.Err))
+
+	case Diagnostic:
+		attrs := []slog.Attr{slog.String("phase", e.Phase)}
+		if e.App != "" {
+			attrs = append(attrs, slog.String("app", e.App))
+		}
+		if e.Name != "" {
+			attrs = append(attrs, slog.String("resource", e.Resource), slog.String("name", e.Name))
+		}
+		if e.Err != nil {
+			attrs = append(attrs, slog.Any("error", e.Err))
+		}
+		observer.log(e.Level, e.Message, attrs...)
+
+	case RunFinished:
+		observer.log(slog.LevelDebug, "run finished", slog.String("mode", e.Run.Mode), slog.Int("apps", len(e.Run.Apps)))
+	}
+}
+
+func (observer logObserver) log(level slog.Level, message string, attrs ...slog.Attr) {
+	observer.logger.LogAttrs(context.Background(), level, message, attrs...)
+}
+
+// pipelineAttrs are the fields of every event of a pipeline run. The pipeline id is left out while it is unknown
+func pipelineAttrs(app string, pipeline string, pipelineID int, runID int) []slog.Attr {
+	attrs := []slog.Attr{slog.String("phase", PhaseQueue), slog.String("app", app), slog.String("resource", "pipeline"), slog.String("name", pipeline)}
+	if pipelineID != 0 {
+		attrs = append(attrs, slog.Int("pipeline_id", pipelineID))
+	}
+	return append(attrs, slog.Int("run_id", runID))
+}
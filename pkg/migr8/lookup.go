@@ -0,0 +1,196 @@
+package migr8
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// resourceGroupExists checks if a resource group exists in the current subscription
+func resourceGroupExists(ctx context.Context, name string) (bool, error) {
+	out, err := exec.CommandContext(ctx, "az", "group", "exists", "--name", name).Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
+
+// storageAccountExists checks if a storage account exists in the current subscription
+func storageAccountExists(ctx context.Context, name string) (bool, error) {
+	return nameExists(ctx, name, "storage", "account", "list")
+}
+
+// appServicePlanExists checks if an app service plan exists in the current subscription
+func appServicePlanExists(ctx context.Context, name string) (bool, error) {
+	return nameExists(ctx, name, "appservice", "plan", "list")
+}
+
+// functionAppExists checks if a function app exists in the current subscription
+func functionAppExists(ctx context.Context, name string) (bool, error) {
+	return nameExists(ctx, name, "functionapp", "list")
+}
+
+// webAppExists checks if a webapp exists in the current subscription
+func webAppExists(ctx context.Context, name string) (bool, error) {
+	return nameExists(ctx, name, "webapp", "list")
+}
+
+// pipelineExists checks if a pipeline exists in the given devops project
+func pipelineExists(ctx context.Context, devopsOrg string, project string, name string) (bool, error) {
+	return nameExists(ctx, name, "pipelines", "list", "--organization", devopsOrg, "--project", project)
+}
+
+// nameExists runs an az list command and checks if any of the returned resources is called name
+func nameExists(ctx context.Context, name string, args ...string) (bool, error) {
+	names, err := azQuery[[]string](ctx, append(args, "--query", "[].name")...)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(names, name), nil
+}
+
+// appServicePlanApps returns the webapps and function apps that are hosted on an app service plan
+func appServicePlanApps(ctx context.Context, name string, resourceGroup string) ([]string, error) {
+	query := fmt.Sprintf("[?ends_with(to_string(appServicePlanId), '/serverfarms/%s') && resourceGroup=='%s'].name", name, resourceGroup)
+
+	var hosted []string
+	for _, kind := range []string{"webapp", "functionapp"} {
+		names, err := azQuery[[]string](ctx, kind, "list", "--query", query)
+		if err != nil {
+			return nil, err
+		}
+		hosted = append(hosted, names...)
+	}
+	return hosted, nil
+}
+
+// storageLookupParallelism caps how many function apps have their settings read at the same time
+const storageLookupParallelism = 8
+
+// storageAccountApps returns the function apps of a resource group that keep their state in a storage account.
+// The settings of the apps are read concurrently. The apps whose settings can't be read are returned in an
+// UnreadableAppsError along with the apps that use the account
+func storageAccountApps(ctx context.Context, name string, resourceGroup string) ([]string, error) {
+	funcApps, err := azQuery[[]string](ctx, "functionapp", "list", "--resource-group", resourceGroup, "--query", "[].name")
+	if err != nil {
+		return nil, err
+	}
+
+	isUser := make([]bool, len(funcApps))
+	readErrs := make([]error, len(funcApps))
+	var waitGroup sync.WaitGroup
+	pool := newWorkerPool(storageLookupParallelism)
+	for i, funcApp := range funcApps {
+		index, appName := i, funcApp
+		waitGroup.Add(1)
+		pool.run(func() {
+			defer waitGroup.Done()
+			connection, err := azQuery[string](ctx, "functionapp", "config", "appsettings", "list",
+				"--name", appName,
+				"--resource-group", resourceGroup,
+				"--query", "[?name=='AzureWebJobsStorage'].value | [0]")
+			readErrs[index] = err
+			isUser[index] = slices.Contains(strings.Split(connection, ";"), "AccountName="+name)
+		})
+	}
+	waitGroup.Wait()
+
+	users := []string{}
+	unreadable := map[string]error{}
+	for i, funcApp := range funcApps {
+		if readErrs[i] != nil {
+			unreadable[funcApp] = readErrs[i]
+			continue
+		}
+		if isUser[i] {
+			users = append(users, funcApp)
+		}
+	}
+	if len(unreadable) > 0 {
+		return users, &UnreadableAppsError{Apps: unreadable}
+	}
+	return users, nil
+}
+
+// resourceGroupResources returns the name, type and sku tier of all the resources in a resource group
+func resourceGroupResources(ctx context.Context, name string) ([]AzureResource, error) {
+	return azQuery[[]AzureResource](ctx, "resource", "list", "--resource-group", name, "--query", "[].{name:name, type:type, skuTier:sku.tier}")
+}
+
+// pipelineID returns the id of a pipeline in the given devops project
+func pipelineID(ctx context.Context, devopsOrg string, project string, name string) (int, error) {
+	return azQuery[int](ctx, "pipelines", "show", "--organization", devopsOrg, "--project", project, "--name", name, "--query", "id")
+}
+
+// pipelineRunURL returns the devops portal url of a pipeline run
+func pipelineRunURL(devopsOrg string, project string, runID int) string {
+	return fmt.Sprintf("%s/%s/_build/results?buildId=%d", strings.TrimSuffix(devopsOrg, "/"), url.PathEscape(project), runID)
+}
+
+// pipelineURL returns the devops portal url of a pipeline
+func pipelineURL(devopsOrg string, project string, pipelineID int) string {
+	return fmt.Sprintf("%s/%s/_build?definitionId=%d", strings.TrimSuffix(devopsOrg, "/"), url.PathEscape(project), pipelineID)
+}
+
+// azureResourceID returns the id of a resource in the subscription of the runner
+func (runner *Runner) azureResourceID(resource string, resourceGroup string, name string) string {
+	groupID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", runner.Options.SubscriptionID, resourceGroup)
+	providers := map[string]string{
+		"storage account":  "Microsoft.Storage/storageAccounts",
+		"app service plan": "Microsoft.Web/serverfarms",
+		"function app":     "Microsoft.Web/sites",
+		"webapp":           "Microsoft.Web/sites",
+		"deployment slot":  "Microsoft.Web/sites",
+	}
+	// a slot is named app/slot and lives under the app
+	if resource == "deployment slot" {
+		name = strings.Replace(name, "/", "/slots/", 1)
+	}
+	if provider, ok := providers[resource]; ok {
+		return groupID + "/providers/" + provider + "/" + name
+	}
+	return groupID
+}
+
+// azQuery runs an az command with json output and deserializes the output into K. An empty output
+// e.g. from a query that matched nothing, results in the zero value of K
+func azQuery[K interface{}](ctx context.Context, args ...string) (K, error) {
+	var model K
+
+	out, err := exec.CommandContext(ctx, "az", append(args, "--output", "json")...).Output()
+	if err != nil {
+		return model, CommandError(err)
+	}
+	if strings.TrimSpace(string(out)) == "" {
+		return model, nil
+	}
+
+	unmarshalErr := json.Unmarshal(out, &model)
+	if unmarshalErr != nil {
+		return model, unmarshalErr
+	}
+	return model, nil
+}
+
+// azRun runs an az command that is only executed for its side effects
+func azRun(ctx context.Context, args ...string) error {
+	_, err := exec.CommandContext(ctx, "az", args...).Output()
+	return CommandError(err)
+}
+
+// CommandError replaces the generic exit status error of a failed command, e.g. az, with the message it printed on
+// stderr. Other errors are returned as they are
+func CommandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
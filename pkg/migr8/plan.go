@@ -0,0 +1,165 @@
+package migr8
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// Plan looks up every resource of the config and decides what a run of the given mode would do with it.
+// Nothing is changed
+func (runner *Runner) Plan(ctx context.Context, mode string) (InfraPlan, error) {
+	if !slices.Contains([]string{ModeComplete, ModeCreate, ModeDeploy}, mode) {
+		return InfraPlan{}, fmt.Errorf("unknown mode %s. Use complete | create | deploy", mode)
+	}
+	isCreate := mode == ModeComplete || mode == ModeCreate
+	isDeploy := mode == ModeComplete || mode == ModeDeploy
+
+	plan := InfraPlan{Mode: mode, Apps: []AppPlan{}}
+	seen := map[string]PlanAction{}
+
+	for _, appDetails := range runner.Config.Infrastructure {
+		runner.diagnose(slog.LevelInfo, PhasePlan, appDetails.Name, "looking up resources", nil)
+
+		appPlan := AppPlan{App: appDetails.Name, Type: appDetails.Type}
+
+		if isCreate {
+			appPlan.Actions = append(appPlan.Actions, runner.planResource(ctx, seen, "resource group", appDetails.ResourceGroup, runner.Provisioner.ResourceGroupExists))
+
+			var appAction PlanAction
+			if appDetails.Type == "function" {
+				appAction = runner.planResource(ctx, seen, "function app", appDetails.Name, runner.Provisioner.FunctionAppExists)
+				appPlan.Actions = append(appPlan.Actions,
+					runner.planResource(ctx, seen, "storage account", appDetails.StorageAccount, runner.Provisioner.StorageAccountExists),
+					appAction,
+				)
+			}
+
+			if appDetails.Type == "webapp" {
+				appAction = runner.planResource(ctx, seen, "webapp", appDetails.Name, runner.Provisioner.WebAppExists)
+				appPlan.Actions = append(appPlan.Actions,
+					runner.planResource(ctx, seen, "app service plan", appDetails.AppServicePlan, runner.Provisioner.AppServicePlanExists),
+					appAction,
+				)
+			}
+
+			if settings := appDetails.SlotSettings(""); len(settings) != 0 && !appDetails.SettingsAsParameters() {
+				appPlan.Actions = append(appPlan.Actions, PlanAction{
+					Action:   "set",
+					Resource: "app settings",
+					Name:     fmt.Sprintf("%d settings", len(settings)),
+					Note:     describeSlotSettings(settings),
+				})
+			}
+
+			appPlan.Actions = append(appPlan.Actions, runner.planSlots(ctx, seen, appDetails, appAction)...)
+		}
+
+		if isDeploy {
+			pipelineLookup := func(ctx context.Context, name string) (bool, error) {
+				return runner.Pipelines.PipelineExists(ctx, runner.Config.DevOpsOrg, appDetails.Pipeline)
+			}
+
+			appPlan.Actions = append(appPlan.Actions,
+				PlanAction{Action: "start", Resource: "agent", Name: appDetails.Name + "_deployment_agent", Note: "pool " + runner.Config.AgentPool},
+				runner.planResource(ctx, seen, "pipeline", appDetails.Pipeline.Name, pipelineLookup),
+				PlanAction{Action: "queue", Resource: "pipeline run", Name: appDetails.Pipeline.Name, Note: runner.describeLastRun(appDetails)},
+			)
+
+			if slot := appDetails.DeploySlot(); slot != nil {
+				appPlan.Actions = append(appPlan.Actions, PlanAction{
+					Action:   "swap",
+					Resource: "deployment slot",
+					Name:     appDetails.Name + "/" + slot.Name,
+					Note:     fmt.Sprintf("into production once %s is healthy", slot.healthCheckPath()),
+				})
+			}
+		}
+
+		plan.Apps = append(plan.Apps, appPlan)
+	}
+
+	return plan, nil
+}
+
+// planResource decides if a resource would be created or reused. Resources that are shared between apps are
+// looked up only once and reused by every app after the first one
+func (runner *Runner) planResource(ctx context.Context, seen map[string]PlanAction, resource string, name string, exists func(context.Context, string) (bool, error)) PlanAction {
+	key := resource + "/" + name
+
+	if previous, ok := seen[key]; ok {
+		if previous.Action == "create" {
+			return PlanAction{Action: "reuse", Resource: resource, Name: name, Note: "created by an earlier app"}
+		}
+		return previous
+	}
+
+	action := PlanAction{Action: "create", Resource: resource, Name: name}
+
+	isFound, err := exists(ctx, name)
+	if err != nil {
+		runner.emit(Diagnostic{Level: slog.LevelError, Phase: PhasePlan, Resource: resource, Name: name, Message: "failed to look up", Err: err})
+		action.Action = "unknown"
+		action.Note = "lookup failed: " + err.Error()
+	}
+	if err == nil && isFound {
+		action.Action = "reuse"
+		action.Note = runner.state.describeResource(resource, name)
+	}
+	if err == nil && !isFound && runner.state.describeResource(resource, name) != "" {
+		action.Note = "in the state but missing in azure"
+	}
+
+	seen[key] = action
+	return action
+}
+
+// planSlots decides if the deployment slots of an app would be created or reused. The slots of an app that
+// would be created can't exist yet, so they aren't looked up
+func (runner *Runner) planSlots(ctx context.Context, seen map[string]PlanAction, appDetails AppDetails, appAction PlanAction) []PlanAction {
+	actions := []PlanAction{}
+	for _, slot := range appDetails.Slots {
+		name := appDetails.Name + "/" + slot.Name
+		action := PlanAction{Action: "create", Resource: "deployment slot", Name: name}
+		if appAction.Action != "create" {
+			slotName := slot.Name
+			action = runner.planResource(ctx, seen, "deployment slot", name, func(ctx context.Context, name string) (bool, error) {
+				return runner.Provisioner.SlotExists(ctx, appDetails, slotName)
+			})
+		}
+		if len(slot.Settings) > 0 && action.Note == "" {
+			action.Note = fmt.Sprintf("%d own settings", len(slot.Settings))
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// describeSlotSettings tells how many settings stay with their slot when slots are swapped
+func describeSlotSettings(settings []AppSettings) string {
+	count := 0
+	for _, setting := range settings {
+		if setting.SlotSetting {
+			count++
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d stay with their slot", count)
+}
+
+// describeLastRun summarizes the branch of the next run and the outcome of the previous one
+func (runner *Runner) describeLastRun(appDetails AppDetails) string {
+	note := "branch " + appDetails.Pipeline.Branch
+
+	app, ok := runner.state.app(appDetails.Name)
+	if !ok || app.RunID == 0 {
+		return note
+	}
+	if app.RunResult == "" {
+		return fmt.Sprintf("%s, last run #%d did not finish", note, app.RunID)
+	}
+	return fmt.Sprintf("%s, last run #%d %s", note, app.RunID, app.RunResult)
+}
@@ -0,0 +1,33 @@
+package migr8
+
+// workerPool ~ caps how many workers of a phase run at the same time
+type workerPool struct {
+	slots chan struct{}
+}
+
+// newWorkerPool creates a pool for size workers. A size of 0 or less doesn't cap anything
+func newWorkerPool(size int) *workerPool {
+	if size <= 0 {
+		return &workerPool{}
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// run starts work in its own goroutine as soon as the pool has a free slot
+func (pool *workerPool) run(work func()) {
+	go func() {
+		if pool.slots != nil {
+			pool.slots <- struct{}{}
+			defer func() { <-pool.slots }()
+		}
+		work()
+	}()
+}
+
+// phaseParallelism returns the limit of a phase. A phase without its own limit falls back to Parallelism
+func (options Options) phaseParallelism(phaseLimit int) int {
+	if phaseLimit > 0 {
+		return phaseLimit
+	}
+	return options.Parallelism
+}
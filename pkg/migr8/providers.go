@@ -0,0 +1,72 @@
+package migr8
+
+import "context"
+
+type (
+	// ResourceProvisioner ~ looks up, creates and deletes the cloud resources that host the apps. Every Create
+	// method is idempotent and skips the creation when the resource already exists
+	ResourceProvisioner interface {
+		ResourceGroupExists(ctx context.Context, name string) (bool, error)
+		CreateResourceGroup(ctx context.Context, app AppDetails) error
+		StorageAccountExists(ctx context.Context, name string) (bool, error)
+		CreateStorageAccount(ctx context.Context, app AppDetails) error
+		AppServicePlanExists(ctx context.Context, name string) (bool, error)
+		CreateAppServicePlan(ctx context.Context, app AppDetails) error
+		FunctionAppExists(ctx context.Context, name string) (bool, error)
+		CreateFunctionApp(ctx context.Context, app AppDetails) error
+		WebAppExists(ctx context.Context, name string) (bool, error)
+		CreateWebApp(ctx context.Context, app AppDetails) error
+		// SetAppSettings adds or updates the given settings of a webapp or function app, or of one of its slots when
+		// slot is set. Other live settings are kept. Settings with slotSetting stay with the slot when slots are swapped
+		SetAppSettings(ctx context.Context, app AppDetails, slot string, settings []AppSettings) error
+		// AppSettings returns the live settings of a webapp or function app, or of one of its slots
+		AppSettings(ctx context.Context, app AppDetails, slot string) ([]AppSettings, error)
+		// DeleteAppSettings deletes the named settings of a webapp or function app, or of one of its slots
+		DeleteAppSettings(ctx context.Context, app AppDetails, slot string, names []string) error
+		// AssignIdentity turns on the system assigned managed identity of an app, or of one of its slots, and
+		// returns its principal id
+		AssignIdentity(ctx context.Context, app AppDetails, slot string) (string, error)
+		// GrantKeyVaultAccess lets a managed identity read the secrets of a Key Vault
+		GrantKeyVaultAccess(ctx context.Context, vault string, principalID string) error
+
+		// SlotExists, CreateSlot and SwapSlot work on the deployment slots of a webapp or function app
+		SlotExists(ctx context.Context, app AppDetails, slot string) (bool, error)
+		CreateSlot(ctx context.Context, app AppDetails, slot string) error
+		SwapSlot(ctx context.Context, app AppDetails, slot string) error
+		// CheckSlotHealth requests the health check path of a slot once and fails unless it answers with a 2xx status
+		CheckSlotHealth(ctx context.Context, app AppDetails, slot Slot) error
+
+		DeleteResourceGroup(ctx context.Context, name string) error
+		DeleteStorageAccount(ctx context.Context, app AppDetails) error
+		DeleteAppServicePlan(ctx context.Context, app AppDetails) error
+		DeleteFunctionApp(ctx context.Context, app AppDetails) error
+		DeleteWebApp(ctx context.Context, app AppDetails) error
+
+		// AppServicePlanApps returns every app hosted on the app service plan of app
+		AppServicePlanApps(ctx context.Context, app AppDetails) ([]string, error)
+		// StorageAccountApps returns every function app of the resource group of app that uses its storage account.
+		// Apps whose settings can't be read are returned in an UnreadableAppsError, along with the apps that use it
+		StorageAccountApps(ctx context.Context, app AppDetails) ([]string, error)
+		// ResourceGroupResources returns every resource left in a resource group
+		ResourceGroupResources(ctx context.Context, name string) ([]AzureResource, error)
+	}
+
+	// PipelineService ~ creates, queues, monitors and deletes the deployment pipelines of the apps
+	PipelineService interface {
+		PipelineExists(ctx context.Context, devopsOrg string, pipeline Pipeline) (bool, error)
+		CreatePipeline(ctx context.Context, devopsOrg string, app AppDetails) error
+		PipelineID(ctx context.Context, devopsOrg string, pipeline Pipeline) (int, error)
+		QueuePipeline(ctx context.Context, devopsOrg string, app AppDetails, parameters []string) (PipelineRun, error)
+		GetPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) (PipelineRun, error)
+		DeletePipeline(ctx context.Context, devopsOrg string, pipeline Pipeline) error
+		// CancelPipelineRun stops a queued or running pipeline run
+		CancelPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) error
+	}
+
+	// AgentRuntime ~ runs the self hosted agents that pick up the queued pipelines
+	AgentRuntime interface {
+		Prepare(ctx context.Context) error
+		StartAgent(ctx context.Context, config AgentConfig) (string, error)
+		Cleanup() error
+	}
+)
@@ -0,0 +1,330 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/G-MAKROGLOU/containers"
+	"github.com/G-MAKROGLOU/devops/agentpool"
+)
+
+const buildCtxPath = "migr8_agentpool_build_ctx"
+
+type (
+	// azureProvisioner ~ the default ResourceProvisioner backed by the az cli
+	azureProvisioner struct{}
+
+	// azurePipelineService ~ the default PipelineService backed by the az devops cli extension
+	azurePipelineService struct{}
+
+	// dockerAgentRuntime ~ the default AgentRuntime that runs every agent in a local docker container
+	dockerAgentRuntime struct {
+		isDockerReady bool
+		// notify reports the progress of building the image and removing the agents
+		notify func(event Event)
+		// starting holds the container names of the agents that are being started. A start that was abandoned
+		// keeps running in the background, so Cleanup waits for it to return
+		mu       sync.Mutex
+		starting map[string]bool
+	}
+)
+
+func (azureProvisioner) ResourceGroupExists(ctx context.Context, name string) (bool, error) {
+	return resourceGroupExists(ctx, name)
+}
+
+func (azureProvisioner) CreateResourceGroup(ctx context.Context, app AppDetails) error {
+	return createResourceGroup(ctx, app)
+}
+
+func (azureProvisioner) StorageAccountExists(ctx context.Context, name string) (bool, error) {
+	return storageAccountExists(ctx, name)
+}
+
+func (azureProvisioner) CreateStorageAccount(ctx context.Context, app AppDetails) error {
+	return createStorageAccount(ctx, app)
+}
+
+func (azureProvisioner) AppServicePlanExists(ctx context.Context, name string) (bool, error) {
+	return appServicePlanExists(ctx, name)
+}
+
+func (azureProvisioner) CreateAppServicePlan(ctx context.Context, app AppDetails) error {
+	return createAppServicePlan(ctx, app)
+}
+
+func (azureProvisioner) FunctionAppExists(ctx context.Context, name string) (bool, error) {
+	return functionAppExists(ctx, name)
+}
+
+func (azureProvisioner) CreateFunctionApp(ctx context.Context, app AppDetails) error {
+	return createFunctionApp(ctx, app)
+}
+
+func (azureProvisioner) WebAppExists(ctx context.Context, name string) (bool, error) {
+	return webAppExists(ctx, name)
+}
+
+func (azureProvisioner) CreateWebApp(ctx context.Context, app AppDetails) error {
+	return createWebApp(ctx, app)
+}
+
+func (azureProvisioner) SetAppSettings(ctx context.Context, app AppDetails, slot string, settings []AppSettings) error {
+	return setAppSettings(ctx, app, slot, settings)
+}
+
+func (azureProvisioner) AppSettings(ctx context.Context, app AppDetails, slot string) ([]AppSettings, error) {
+	return appSettings(ctx, app, slot)
+}
+
+func (azureProvisioner) DeleteAppSettings(ctx context.Context, app AppDetails, slot string, names []string) error {
+	return deleteAppSettings(ctx, app, slot, names)
+}
+
+func (azureProvisioner) AssignIdentity(ctx context.Context, app AppDetails, slot string) (string, error) {
+	return assignIdentity(ctx, app, slot)
+}
+
+func (azureProvisioner) GrantKeyVaultAccess(ctx context.Context, vault string, principalID string) error {
+	return grantKeyVaultAccess(ctx, vault, principalID)
+}
+
+func (azureProvisioner) SlotExists(ctx context.Context, app AppDetails, slot string) (bool, error) {
+	return slotExists(ctx, app, slot)
+}
+
+func (azureProvisioner) CreateSlot(ctx context.Context, app AppDetails, slot string) error {
+	return createSlot(ctx, app, slot)
+}
+
+func (azureProvisioner) SwapSlot(ctx context.Context, app AppDetails, slot string) error {
+	return swapSlot(ctx, app, slot)
+}
+
+func (azureProvisioner) CheckSlotHealth(ctx context.Context, app AppDetails, slot Slot) error {
+	return checkSlotHealth(ctx, app, slot)
+}
+
+func (azureProvisioner) DeleteResourceGroup(ctx context.Context, name string) error {
+	return deleteResourceGroup(ctx, name)
+}
+
+func (azureProvisioner) DeleteStorageAccount(ctx context.Context, app AppDetails) error {
+	return deleteStorageAccount(ctx, app.StorageAccount, app.ResourceGroup)
+}
+
+func (azureProvisioner) DeleteAppServicePlan(ctx context.Context, app AppDetails) error {
+	return deleteAppServicePlan(ctx, app.AppServicePlan, app.ResourceGroup)
+}
+
+func (azureProvisioner) DeleteFunctionApp(ctx context.Context, app AppDetails) error {
+	return deleteFunctionApp(ctx, app.Name, app.ResourceGroup)
+}
+
+func (azureProvisioner) DeleteWebApp(ctx context.Context, app AppDetails) error {
+	return deleteWebApp(ctx, app.Name, app.ResourceGroup)
+}
+
+func (azureProvisioner) AppServicePlanApps(ctx context.Context, app AppDetails) ([]string, error) {
+	return appServicePlanApps(ctx, app.AppServicePlan, app.ResourceGroup)
+}
+
+func (azureProvisioner) StorageAccountApps(ctx context.Context, app AppDetails) ([]string, error) {
+	return storageAccountApps(ctx, app.StorageAccount, app.ResourceGroup)
+}
+
+func (azureProvisioner) ResourceGroupResources(ctx context.Context, name string) ([]AzureResource, error) {
+	return resourceGroupResources(ctx, name)
+}
+
+func (azurePipelineService) PipelineExists(ctx context.Context, devopsOrg string, pipeline Pipeline) (bool, error) {
+	return pipelineExists(ctx, devopsOrg, pipeline.Project, pipeline.Name)
+}
+
+func (azurePipelineService) CreatePipeline(ctx context.Context, devopsOrg string, app AppDetails) error {
+	return createPipeline(ctx, devopsOrg, app)
+}
+
+func (azurePipelineService) PipelineID(ctx context.Context, devopsOrg string, pipeline Pipeline) (int, error) {
+	return pipelineID(ctx, devopsOrg, pipeline.Project, pipeline.Name)
+}
+
+func (azurePipelineService) QueuePipeline(ctx context.Context, devopsOrg string, app AppDetails, parameters []string) (PipelineRun, error) {
+	return queuePipeline(ctx, devopsOrg, app, parameters)
+}
+
+func (azurePipelineService) GetPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) (PipelineRun, error) {
+	return pipelineRun(ctx, devopsOrg, project, runID)
+}
+
+func (azurePipelineService) DeletePipeline(ctx context.Context, devopsOrg string, pipeline Pipeline) error {
+	return deletePipeline(ctx, devopsOrg, pipeline.Project, pipeline.Name)
+}
+
+func (azurePipelineService) CancelPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) error {
+	return cancelPipelineRun(ctx, devopsOrg, project, runID)
+}
+
+// Prepare creates the build context and builds the agent image that every agent container runs
+func (runtime *dockerAgentRuntime) Prepare(ctx context.Context) error {
+	stat, _ := os.Stat(buildCtxPath)
+	if stat == nil {
+		if err := agentpool.CreateBuildCtx(buildCtxPath); err != nil {
+			return err
+		}
+	}
+
+	runtime.diagnose(slog.LevelInfo, "initializing docker client")
+	initDockerClientErr := containers.InitializeDockerClient()
+	if initDockerClientErr != nil {
+		return initDockerClientErr
+	}
+	runtime.isDockerReady = true
+
+	dir, homeDirErr := os.Getwd()
+	if homeDirErr != nil {
+		return errors.New("[ERR:] => HOME DIR => " + homeDirErr.Error())
+	}
+
+	runtime.diagnose(slog.LevelInfo, "building agent pool image")
+
+	buildErr := awaitCall(ctx, func() error {
+		return containers.BuildImage(filepath.Join(dir, buildCtxPath), "azp_agent")
+	}, func(err error) {
+		// nothing runs the image of an abandoned build, so it is deleted as soon as the build is done
+		if err == nil {
+			containers.DeleteImage("azp_agent:latest")
+		}
+	})
+	if buildErr != nil {
+		return errors.New("[ERR:] => IMAGE BUILD => " + buildErr.Error())
+	}
+
+	runtime.diagnose(slog.LevelInfo, "agent pool image built successfully")
+	return nil
+}
+
+func (runtime *dockerAgentRuntime) StartAgent(ctx context.Context, config AgentConfig) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	runtime.setStarting(config.Name, true)
+	return awaitValue(ctx, func() (string, error) {
+		defer runtime.setStarting(config.Name, false)
+		return agentpool.StartAgentPool(agentpool.ConfigDetails{
+			Org:           config.DevOpsOrg,
+			Pat:           config.Pat,
+			Pool:          config.Pool,
+			ContainerName: config.Name,
+		})
+	}, func(string, error) {
+		// nothing waits for the agent anymore, so it is removed instead of idling until Cleanup
+		runtime.removeAgent(config.Name)
+	})
+}
+
+// Cleanup stops and removes every agent container, the agent image and the build context
+func (runtime *dockerAgentRuntime) Cleanup() error {
+	var errs []error
+
+	// delete img build ctx
+	delErr := os.RemoveAll(buildCtxPath)
+	if delErr != nil {
+		errs = append(errs, errors.New("[ERR]: FAILED TO DELETE BUILD CONTEXT DIRECTORY"))
+	}
+
+	// nothing was started if the docker client was never initialized
+	if !runtime.isDockerReady {
+		return errors.Join(errs...)
+	}
+
+	// agents that are still starting are removed by name until their start returns. Removing the container makes
+	// a start that waits for the agent to become healthy fail right away
+	for names := runtime.startingAgents(); len(names) > 0; names = runtime.startingAgents() {
+		for _, name := range names {
+			runtime.removeAgent(name)
+		}
+		time.Sleep(time.Second)
+	}
+
+	// stop and remove all created containers
+	for _, contID := range agentpool.ContainerIDs {
+		stopErr := containers.StopContainer(contID)
+		if stopErr != nil {
+			errs = append(errs, stopErr)
+		}
+		purgeErr := containers.PurgeContainer(contID)
+		if purgeErr != nil {
+			errs = append(errs, purgeErr)
+		}
+	}
+
+	// remove image
+	imgExists, delImgErr := containers.DeleteImage("azp_agent:latest")
+	if delImgErr != nil {
+		errs = append(errs, delImgErr)
+	}
+	if !imgExists {
+		runtime.diagnose(slog.LevelWarn, "image does not exist. Skipping image deletion")
+	}
+
+	// remove any possible dangling images
+	pruneReport, pruneErr := containers.PruneDanglingImages()
+	if pruneErr != nil {
+		errs = append(errs, pruneErr)
+	}
+	if pruneErr == nil {
+		runtime.diagnose(slog.LevelInfo, fmt.Sprintf("pruned %d dangling images. Reclaimed %d space", len(pruneReport.ImagesDeleted), pruneReport.SpaceReclaimed))
+	}
+
+	return errors.Join(errs...)
+}
+
+// setStarting marks an agent as being started, or as done starting
+func (runtime *dockerAgentRuntime) setStarting(name string, isStarting bool) {
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	if runtime.starting == nil {
+		runtime.starting = map[string]bool{}
+	}
+	if isStarting {
+		runtime.starting[name] = true
+		return
+	}
+	delete(runtime.starting, name)
+}
+
+// startingAgents returns the container names of the agents that are still being started
+func (runtime *dockerAgentRuntime) startingAgents() []string {
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	names := make([]string, 0, len(runtime.starting))
+	for name := range runtime.starting {
+		names = append(names, name)
+	}
+	return names
+}
+
+// removeAgent force removes the container of an agent by name. The container may not exist yet or anymore, so
+// errors are ignored
+func (runtime *dockerAgentRuntime) removeAgent(name string) {
+	if err := containers.PurgeContainer(name); err == nil {
+		runtime.diagnose(slog.LevelInfo, fmt.Sprintf("removed agent %s whose start was abandoned", name))
+	}
+}
+
+// diagnose reports the progress of the runtime, if anyone listens
+func (runtime *dockerAgentRuntime) diagnose(level slog.Level, message string) {
+	if runtime.notify != nil {
+		runtime.notify(Diagnostic{Level: level, Phase: PhaseAgent, Message: message})
+	}
+}
@@ -0,0 +1,429 @@
+package migr8
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// fakeBackend ~ an in-memory ResourceProvisioner, PipelineService and AgentRuntime. It lets the whole
+// orchestration run without Azure, Azure DevOPS or Docker. Failures are injected per operation and resource
+// name with fail, e.g. fail("CreateWebApp", "my-app", err)
+type fakeBackend struct {
+	mu        sync.Mutex
+	resources map[string]bool
+	// groups maps every resource to its resource group and hosts every app to its plan or storage account
+	groups   map[string]string
+	hosts    map[string][]string
+	settings map[string][]AppSettings
+	// set holds the names of the settings that every SetAppSettings call was given, in order
+	set       map[string][][]string
+	runs      map[int]PipelineRun
+	pipelines map[string]int
+	agents    []string
+	failures  map[string]error
+	calls     []string
+	nextRunID int
+	// runResult is the result that every queued run completes with. Defaults to succeeded
+	runResult string
+	// runStatus is the status that every queued run stays in until it is cancelled. Defaults to completed
+	runStatus string
+}
+
+// newFakeBackend creates an empty fakeBackend. Pass resources that should already exist as "kind/name"
+// e.g. "resource group/my-rg"
+func newFakeBackend(existing ...string) *fakeBackend {
+	fake := &fakeBackend{
+		resources: map[string]bool{},
+		groups:    map[string]string{},
+		hosts:     map[string][]string{},
+		settings:  map[string][]AppSettings{},
+		set:       map[string][][]string{},
+		runs:      map[int]PipelineRun{},
+		pipelines: map[string]int{},
+		failures:  map[string]error{},
+		nextRunID: 1,
+		runResult: "succeeded",
+		runStatus: "completed",
+	}
+	for _, key := range existing {
+		fake.resources[key] = true
+	}
+	return fake
+}
+
+// useFakeBackend replaces every backend of the runner with the given fake
+func (runner *Runner) useFakeBackend(fake *fakeBackend) {
+	runner.Provisioner = fake
+	runner.Pipelines = fake
+	runner.Agents = fake
+}
+
+// fail makes every call of op for the given resource name return err
+func (f *fakeBackend) fail(op string, name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[op+"/"+name] = err
+}
+
+func (f *fakeBackend) record(op string, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, op+"/"+name)
+	return f.failures[op+"/"+name]
+}
+
+func (f *fakeBackend) exists(op string, kind string, name string) (bool, error) {
+	if err := f.record(op, name); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resources[kind+"/"+name], nil
+}
+
+func (f *fakeBackend) create(op string, kind string, name string, resourceGroup string) error {
+	if err := f.record(op, name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resources[kind+"/"+name] = true
+	if resourceGroup != "" {
+		f.groups[kind+"/"+name] = resourceGroup
+	}
+	return nil
+}
+
+// host records that app lives on the given plan or storage account
+func (f *fakeBackend) host(host string, app string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.hosts[host], app) {
+		f.hosts[host] = append(f.hosts[host], app)
+	}
+}
+
+func (f *fakeBackend) delete(op string, kind string, name string) error {
+	if err := f.record(op, name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := kind + "/" + name
+	if !f.resources[key] {
+		return fmt.Errorf("%s %s not found", kind, name)
+	}
+	delete(f.resources, key)
+	delete(f.groups, key)
+	for host, apps := range f.hosts {
+		f.hosts[host] = slices.DeleteFunc(apps, func(app string) bool { return app == name })
+	}
+	return nil
+}
+
+func (f *fakeBackend) hosted(op string, host string) ([]string, error) {
+	if err := f.record(op, host); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.hosts[host]), nil
+}
+
+func (f *fakeBackend) ResourceGroupExists(ctx context.Context, name string) (bool, error) {
+	return f.exists("ResourceGroupExists", "resource group", name)
+}
+
+func (f *fakeBackend) CreateResourceGroup(ctx context.Context, app AppDetails) error {
+	return f.create("CreateResourceGroup", "resource group", app.ResourceGroup, "")
+}
+
+func (f *fakeBackend) StorageAccountExists(ctx context.Context, name string) (bool, error) {
+	return f.exists("StorageAccountExists", "storage account", name)
+}
+
+func (f *fakeBackend) CreateStorageAccount(ctx context.Context, app AppDetails) error {
+	return f.create("CreateStorageAccount", "storage account", app.StorageAccount, app.ResourceGroup)
+}
+
+func (f *fakeBackend) AppServicePlanExists(ctx context.Context, name string) (bool, error) {
+	return f.exists("AppServicePlanExists", "app service plan", name)
+}
+
+func (f *fakeBackend) CreateAppServicePlan(ctx context.Context, app AppDetails) error {
+	return f.create("CreateAppServicePlan", "app service plan", app.AppServicePlan, app.ResourceGroup)
+}
+
+func (f *fakeBackend) FunctionAppExists(ctx context.Context, name string) (bool, error) {
+	return f.exists("FunctionAppExists", "function app", name)
+}
+
+func (f *fakeBackend) CreateFunctionApp(ctx context.Context, app AppDetails) error {
+	if err := f.create("CreateFunctionApp", "function app", app.Name, app.ResourceGroup); err != nil {
+		return err
+	}
+	f.host("storage account/"+app.StorageAccount, app.Name)
+	return nil
+}
+
+func (f *fakeBackend) WebAppExists(ctx context.Context, name string) (bool, error) {
+	return f.exists("WebAppExists", "webapp", name)
+}
+
+func (f *fakeBackend) CreateWebApp(ctx context.Context, app AppDetails) error {
+	if err := f.create("CreateWebApp", "webapp", app.Name, app.ResourceGroup); err != nil {
+		return err
+	}
+	f.host("app service plan/"+app.AppServicePlan, app.Name)
+	return nil
+}
+
+// SetAppSettings keeps the settings per app, or per app and slot as "app/slot". Like az it only adds and updates
+// settings, the ones that aren't given are kept
+func (f *fakeBackend) SetAppSettings(ctx context.Context, app AppDetails, slot string, settings []AppSettings) error {
+	key := strings.TrimSuffix(app.Name+"/"+slot, "/")
+	if err := f.record("SetAppSettings", key); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for _, setting := range settings {
+		names = append(names, setting.Name)
+		index := slices.IndexFunc(f.settings[key], func(live AppSettings) bool { return live.Name == setting.Name })
+		if index == -1 {
+			f.settings[key] = append(f.settings[key], setting)
+			continue
+		}
+		f.settings[key][index] = setting
+	}
+	f.set[key] = append(f.set[key], names)
+	return nil
+}
+
+func (f *fakeBackend) AppSettings(ctx context.Context, app AppDetails, slot string) ([]AppSettings, error) {
+	key := strings.TrimSuffix(app.Name+"/"+slot, "/")
+	if err := f.record("AppSettings", key); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.settings[key]), nil
+}
+
+func (f *fakeBackend) DeleteAppSettings(ctx context.Context, app AppDetails, slot string, names []string) error {
+	key := strings.TrimSuffix(app.Name+"/"+slot, "/")
+	if err := f.record("DeleteAppSettings", key); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settings[key] = slices.DeleteFunc(f.settings[key], func(live AppSettings) bool { return slices.Contains(names, live.Name) })
+	return nil
+}
+
+// AssignIdentity returns "principal-" followed by the app or "app/slot"
+func (f *fakeBackend) AssignIdentity(ctx context.Context, app AppDetails, slot string) (string, error) {
+	key := strings.TrimSuffix(app.Name+"/"+slot, "/")
+	if err := f.record("AssignIdentity", key); err != nil {
+		return "", err
+	}
+	return "principal-" + key, nil
+}
+
+// GrantKeyVaultAccess records the grants in calls as "GrantKeyVaultAccess/vault/principal"
+func (f *fakeBackend) GrantKeyVaultAccess(ctx context.Context, vault string, principalID string) error {
+	return f.record("GrantKeyVaultAccess", vault+"/"+principalID)
+}
+
+func (f *fakeBackend) SlotExists(ctx context.Context, app AppDetails, slot string) (bool, error) {
+	return f.exists("SlotExists", "deployment slot", app.Name+"/"+slot)
+}
+
+func (f *fakeBackend) CreateSlot(ctx context.Context, app AppDetails, slot string) error {
+	return f.create("CreateSlot", "deployment slot", app.Name+"/"+slot, "")
+}
+
+// SwapSlot records the swaps in calls. Fail "CheckSlotHealth" with "app/slot" to keep a slot unhealthy
+func (f *fakeBackend) SwapSlot(ctx context.Context, app AppDetails, slot string) error {
+	return f.record("SwapSlot", app.Name+"/"+slot)
+}
+
+func (f *fakeBackend) CheckSlotHealth(ctx context.Context, app AppDetails, slot Slot) error {
+	return f.record("CheckSlotHealth", app.Name+"/"+slot.Name)
+}
+
+func (f *fakeBackend) DeleteResourceGroup(ctx context.Context, name string) error {
+	if err := f.delete("DeleteResourceGroup", "resource group", name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, resourceGroup := range f.groups {
+		if resourceGroup == name {
+			delete(f.resources, key)
+			delete(f.groups, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) DeleteStorageAccount(ctx context.Context, app AppDetails) error {
+	return f.delete("DeleteStorageAccount", "storage account", app.StorageAccount)
+}
+
+func (f *fakeBackend) DeleteAppServicePlan(ctx context.Context, app AppDetails) error {
+	return f.delete("DeleteAppServicePlan", "app service plan", app.AppServicePlan)
+}
+
+func (f *fakeBackend) DeleteFunctionApp(ctx context.Context, app AppDetails) error {
+	return f.delete("DeleteFunctionApp", "function app", app.Name)
+}
+
+func (f *fakeBackend) DeleteWebApp(ctx context.Context, app AppDetails) error {
+	return f.delete("DeleteWebApp", "webapp", app.Name)
+}
+
+func (f *fakeBackend) AppServicePlanApps(ctx context.Context, app AppDetails) ([]string, error) {
+	return f.hosted("AppServicePlanApps", "app service plan/"+app.AppServicePlan)
+}
+
+func (f *fakeBackend) StorageAccountApps(ctx context.Context, app AppDetails) ([]string, error) {
+	return f.hosted("StorageAccountApps", "storage account/"+app.StorageAccount)
+}
+
+// fakeResourceTypes are the azure types of the kinds of resources that the fake keeps
+var fakeResourceTypes = map[string]AzureResource{
+	"storage account":      {Type: "Microsoft.Storage/storageAccounts"},
+	"app service plan":     {Type: "Microsoft.Web/serverFarms", SkuTier: "Free"},
+	"consumption plan":     {Type: "Microsoft.Web/serverFarms", SkuTier: "Dynamic"},
+	"function app":         {Type: "Microsoft.Web/sites"},
+	"webapp":               {Type: "Microsoft.Web/sites"},
+	"deployment slot":      {Type: "Microsoft.Web/sites/slots"},
+	"application insights": {Type: "microsoft.insights/components"},
+}
+
+func (f *fakeBackend) ResourceGroupResources(ctx context.Context, name string) ([]AzureResource, error) {
+	if err := f.record("ResourceGroupResources", name); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resources []AzureResource
+	for key, resourceGroup := range f.groups {
+		if resourceGroup == name {
+			kind, resourceName, _ := strings.Cut(key, "/")
+			resource := fakeResourceTypes[kind]
+			resource.Name = resourceName
+			resources = append(resources, resource)
+		}
+	}
+	slices.SortFunc(resources, func(a AzureResource, b AzureResource) int { return strings.Compare(a.Name, b.Name) })
+	return resources, nil
+}
+
+func (f *fakeBackend) PipelineExists(ctx context.Context, devopsOrg string, pipeline Pipeline) (bool, error) {
+	return f.exists("PipelineExists", "pipeline", pipeline.Name)
+}
+
+func (f *fakeBackend) CreatePipeline(ctx context.Context, devopsOrg string, app AppDetails) error {
+	return f.create("CreatePipeline", "pipeline", app.Pipeline.Name, "")
+}
+
+func (f *fakeBackend) PipelineID(ctx context.Context, devopsOrg string, pipeline Pipeline) (int, error) {
+	if err := f.record("PipelineID", pipeline.Name); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.resources["pipeline/"+pipeline.Name] {
+		return 0, fmt.Errorf("pipeline %s not found", pipeline.Name)
+	}
+	if _, ok := f.pipelines[pipeline.Name]; !ok {
+		f.pipelines[pipeline.Name] = len(f.pipelines) + 1
+	}
+	return f.pipelines[pipeline.Name], nil
+}
+
+func (f *fakeBackend) QueuePipeline(ctx context.Context, devopsOrg string, app AppDetails, parameters []string) (PipelineRun, error) {
+	if err := f.record("QueuePipeline", app.Pipeline.Name); err != nil {
+		return PipelineRun{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	run := PipelineRun{
+		ID:     f.nextRunID,
+		Status: f.runStatus,
+		Result: f.runResult,
+		URL:    pipelineRunURL(devopsOrg, app.Pipeline.Project, f.nextRunID),
+	}
+	f.runs[run.ID] = run
+	f.nextRunID++
+	return PipelineRun{ID: run.ID, Status: "notStarted", URL: run.URL}, nil
+}
+
+func (f *fakeBackend) GetPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) (PipelineRun, error) {
+	if err := f.record("GetPipelineRun", fmt.Sprint(runID)); err != nil {
+		return PipelineRun{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	run, ok := f.runs[runID]
+	if !ok {
+		return PipelineRun{}, fmt.Errorf("pipeline run %d not found", runID)
+	}
+	return run, nil
+}
+
+func (f *fakeBackend) DeletePipeline(ctx context.Context, devopsOrg string, pipeline Pipeline) error {
+	return f.delete("DeletePipeline", "pipeline", pipeline.Name)
+}
+
+func (f *fakeBackend) CancelPipelineRun(ctx context.Context, devopsOrg string, project string, runID int) error {
+	if err := f.record("CancelPipelineRun", fmt.Sprint(runID)); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	run, ok := f.runs[runID]
+	if !ok {
+		return fmt.Errorf("pipeline run %d not found", runID)
+	}
+	run.Status = "completed"
+	run.Result = "canceled"
+	f.runs[runID] = run
+	return nil
+}
+
+func (f *fakeBackend) Prepare(ctx context.Context) error {
+	return f.record("Prepare", "")
+}
+
+func (f *fakeBackend) StartAgent(ctx context.Context, config AgentConfig) (string, error) {
+	if err := f.record("StartAgent", config.Name); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.agents = append(f.agents, config.Name)
+	return config.Name, nil
+}
+
+func (f *fakeBackend) Cleanup() error {
+	if err := f.record("Cleanup", ""); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.agents = nil
+	return nil
+}
@@ -0,0 +1,82 @@
+package migr8
+
+import "slices"
+
+// Report summarizes the run per app. Only the phases that apply to an app are reported, e.g. swap only for apps
+// with a deploy slot, and apps that no phase applies to are left out. A phase that never started because the run
+// was interrupted is not applicable
+func (r *Run) Report() RunReport {
+	report := RunReport{
+		Mode:            r.Mode,
+		StartedAt:       r.StartedAt,
+		FinishedAt:      r.FinishedAt,
+		DurationSeconds: r.FinishedAt.Sub(r.StartedAt).Seconds(),
+		Apps:            []AppReport{},
+	}
+
+	phases := []struct {
+		name    string
+		results []PhaseResult
+	}{
+		{PhaseAgent, r.Agents},
+		{PhaseInfrastructure, r.Infrastructure},
+		{PhasePipeline, r.Pipelines},
+		{PhaseQueue, r.Queues},
+		{PhaseSwap, r.Swaps},
+	}
+
+	for _, app := range r.Apps {
+		appReport := AppReport{App: app.Name, Type: app.Type, Phases: []PhaseReport{}}
+		statuses := []string{}
+		for _, phase := range phases {
+			if !r.Applies(phase.name, app) {
+				continue
+			}
+			result := r.Result(phase.results, app.Name)
+			statuses = append(statuses, result.Status)
+
+			phaseReport := PhaseReport{Phase: phase.name, Status: result.Status, DurationSeconds: result.Duration.Seconds(), Reason: result.Reason, Resources: result.Resources}
+			if result.Err != nil {
+				phaseReport.Error = result.Err.Error()
+			}
+			appReport.Phases = append(appReport.Phases, phaseReport)
+			appReport.DurationSeconds += phaseReport.DurationSeconds
+		}
+
+		if len(statuses) == 0 {
+			continue
+		}
+
+		switch {
+		case slices.Contains(statuses, StatusFailed):
+			appReport.Status = StatusFailed
+			report.Failed++
+		case !slices.ContainsFunc(statuses, func(status string) bool { return status != StatusSucceeded }):
+			appReport.Status = StatusSucceeded
+			report.Succeeded++
+		default:
+			appReport.Status = StatusSkipped
+			report.Skipped++
+		}
+
+		appReport.RunURL = r.runURL(app.Name)
+		report.Apps = append(report.Apps, appReport)
+	}
+
+	return report
+}
+
+// runURL returns the url of the pipeline run that the queue phase queued or reattached to for an app, or of the
+// run that --resume found already succeeded. It is empty if no run belongs to this run
+func (r *Run) runURL(appName string) string {
+	result := r.Result(r.Queues, appName)
+	if len(result.Resources) > 0 {
+		return result.Resources[0]
+	}
+
+	if _, isResumed := r.Skipped[appName]; !isResumed {
+		return ""
+	}
+	appState, _ := r.runner.state.app(appName)
+	return appState.RunURL
+}
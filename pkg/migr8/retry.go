@@ -0,0 +1,177 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"time"
+)
+
+// the classes of errors that a retry policy tells apart. Only throttling, server and network errors are retried
+const (
+	errorThrottling = "throttling"
+	errorServer     = "server"
+	errorNetwork    = "network"
+	errorAuth       = "auth"
+	errorPermanent  = "permanent"
+)
+
+// the defaults of every retry setting that neither the config nor the app sets
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 2 * time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
+	defaultRetryJitter    = 0.2
+)
+
+// errorPatterns match the error codes and HTTP statuses that az, az devops and the docker daemon print, per error
+// class. Statuses are only matched the way they are printed, e.g. "(429)", "status code 503" or "502 Bad Gateway",
+// so that a number in a resource name or an id doesn't decide the class
+var errorPatterns = map[string]*regexp.Regexp{
+	errorAuth: regexp.MustCompile(`(?i)\baz login\b|\bAADSTS\d+|\b(?:AuthorizationFailed|AuthenticationFailed|InvalidAuthenticationToken|ExpiredAuthenticationToken|TF400813)\b|` +
+		`personal access token|` + statusPattern(`401|403`, `Unauthorized|Forbidden`)),
+	errorThrottling: regexp.MustCompile(`(?i)\b(?:TooManyRequests|RequestThrottled|SubscriptionRequestsThrottled)\b|too many requests|rate limit exceeded|` +
+		statusPattern(`429`, `Too Many Requests`)),
+	errorServer: regexp.MustCompile(`(?i)\b(?:InternalServerError|ServiceUnavailable|BadGateway|GatewayTimeout|ServerTimeout)\b|` +
+		statusPattern(`500|502|503|504`, `Internal Server Error|Bad Gateway|Service Unavailable|Gateway Time-?out`)),
+	errorNetwork: regexp.MustCompile(`(?i)connection reset by peer|connection refused|connection aborted|i/o timeout|tls handshake timeout|read timed out|` +
+		`no such host|unexpected eof|broken pipe|network is unreachable|temporary failure in name resolution|max retries exceeded`),
+}
+
+// statusPattern matches the HTTP status codes as "(code)", "status code", "status: code", "HTTP code" or
+// "code reason"
+func statusPattern(codes string, reasons string) string {
+	return `\((?:` + codes + `)\)|\b(?:status(?: code)?|http(?:/[\d.]+)?)[:= ]+(?:` + codes + `)\b|\b(?:` + codes + `) (?:` + reasons + `)\b`
+}
+
+// retrier ~ retries the failed calls of an app with its policy and reports every retry
+type retrier struct {
+	app       string
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	jitter    float64
+	notify    func(event Event)
+}
+
+// retrier returns the retrier of an app. Its own retry settings win over the global ones, and anything that
+// neither sets falls back to the defaults. The config is validated beforehand
+func (runner *Runner) retrier(app AppDetails) retrier {
+	retry := retrier{
+		app:       app.Name,
+		attempts:  defaultRetryAttempts,
+		baseDelay: defaultRetryBaseDelay,
+		maxDelay:  defaultRetryMaxDelay,
+		jitter:    defaultRetryJitter,
+		notify:    runner.emit,
+	}
+	for _, override := range []*RetryPolicy{runner.Config.Retry, app.Retry} {
+		if override == nil {
+			continue
+		}
+		if override.Attempts != nil {
+			retry.attempts = *override.Attempts
+		}
+		if delay, err := time.ParseDuration(override.BaseDelay); err == nil {
+			retry.baseDelay = delay
+		}
+		if delay, err := time.ParseDuration(override.MaxDelay); err == nil {
+			retry.maxDelay = delay
+		}
+		if override.Jitter != nil {
+			retry.jitter = *override.Jitter
+		}
+	}
+	return retry
+}
+
+// withRetry calls call until it succeeds, fails with an error that isn't worth retrying, runs out of attempts
+// or ctx is done. A call that fails because ctx is done is never retried
+func withRetry[K interface{}](ctx context.Context, retry retrier, operation string, call func() (K, error)) (K, error) {
+	var result K
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		result, err = call()
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		class := classifyError(err)
+		if !isRetryable(class) || attempt >= retry.attempts {
+			return result, err
+		}
+
+		delay := retry.delay(attempt)
+		retry.notify(RetryScheduled{App: retry.app, Operation: operation, Class: class, Attempt: attempt + 1, Attempts: retry.attempts, Delay: delay, Err: err})
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return result, sleepErr
+		}
+	}
+}
+
+// retryCall is withRetry for calls that return nothing but an error
+func retryCall(ctx context.Context, retry retrier, operation string, call func() error) error {
+	_, err := withRetry(ctx, retry, operation, func() (struct{}, error) { return struct{}{}, call() })
+	return err
+}
+
+// classifyError tells which class an error belongs to, based on its type and on the message az printed
+func classifyError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorNetwork
+	}
+
+	message := CommandError(err).Error()
+	for _, class := range []string{errorAuth, errorThrottling, errorServer, errorNetwork} {
+		if errorPatterns[class].MatchString(message) {
+			return class
+		}
+	}
+	return errorPermanent
+}
+
+func isRetryable(class string) bool {
+	return class == errorThrottling || class == errorServer || class == errorNetwork
+}
+
+// delay doubles the base delay on every attempt up to the max delay and spreads it by the jitter fraction
+func (retry retrier) delay(attempt int) time.Duration {
+	delay := retry.baseDelay
+	for i := 1; i < attempt && delay < retry.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, retry.maxDelay)
+
+	jitter := min(max(retry.jitter, 0), 1)
+	return time.Duration(float64(delay) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// checkRetryPolicy returns the mistakes of a retry policy found at path
+func checkRetryPolicy(path string, policy *RetryPolicy) []ValidationError {
+	validationErrs := []ValidationError{}
+	if policy == nil {
+		return validationErrs
+	}
+
+	if policy.Attempts != nil && *policy.Attempts < 1 {
+		validationErrs = append(validationErrs, ValidationError{path + ".attempts", "must be 1 or more"})
+	}
+	delays := map[string]string{"baseDelay": policy.BaseDelay, "maxDelay": policy.MaxDelay}
+	for _, property := range []string{"baseDelay", "maxDelay"} {
+		if _, err := time.ParseDuration(delays[property]); delays[property] != "" && err != nil {
+			validationErrs = append(validationErrs, ValidationError{path + "." + property, fmt.Sprintf("%q is not a duration, e.g. 2s or 1m30s", delays[property])})
+		}
+	}
+	if policy.Jitter != nil && (*policy.Jitter < 0 || *policy.Jitter > 1) {
+		validationErrs = append(validationErrs, ValidationError{path + ".jitter", "must be between 0 and 1"})
+	}
+	return validationErrs
+}
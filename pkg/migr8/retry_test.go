@@ -0,0 +1,58 @@
+package migr8
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		message string
+		class   string
+	}{
+		{"ERROR: (AuthorizationFailed) The client 'x' does not have authorization", errorAuth},
+		{"AADSTS700082: The refresh token has expired", errorAuth},
+		{"Please run 'az login' to setup account.", errorAuth},
+		{"Operation returned an invalid status code 403 Forbidden", errorAuth},
+		{"(TooManyRequests) The request is throttled", errorThrottling},
+		{"HTTP 429 Too Many Requests", errorThrottling},
+		{"(ServiceUnavailable) The service is unavailable", errorServer},
+		{"Received status code: 502", errorServer},
+		{"504 Gateway Timeout", errorServer},
+		{"dial tcp: lookup management.azure.com: no such host", errorNetwork},
+		{"read tcp 10.0.0.1:443: connection reset by peer", errorNetwork},
+		// numbers and words inside names and messages don't decide the class
+		{"(ResourceNotFound) The storage account sa500 was not found", errorPermanent},
+		{"(Conflict) Webapp app-401-web already exists", errorPermanent},
+		{"the pipeline timeout-check has no yaml", errorPermanent},
+		{"(InvalidTemplate) the value of property 'eof' is invalid", errorPermanent},
+	}
+	for _, test := range tests {
+		if class := classifyError(errors.New(test.message)); class != test.class {
+			t.Errorf("%q is a %s error, want %s", test.message, class, test.class)
+		}
+	}
+}
+
+func TestRetrierMergesThePolicies(t *testing.T) {
+	attempts, jitter := 5, 0.0
+	runner := &Runner{Config: InfraConfig{Retry: &RetryPolicy{Attempts: &attempts, BaseDelay: "1s"}}}
+	app := AppDetails{Name: "api", Retry: &RetryPolicy{MaxDelay: "4s", Jitter: &jitter}}
+
+	retry := runner.retrier(app)
+	if retry.attempts != 5 || retry.baseDelay != time.Second || retry.maxDelay != 4*time.Second || retry.jitter != 0 {
+		t.Fatalf("unexpected retrier %+v", retry)
+	}
+	// without jitter the delays are exact
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 4 * time.Second} {
+		if delay := retry.delay(attempt); delay != want {
+			t.Errorf("the delay of attempt %d is %s, want %s", attempt, delay, want)
+		}
+	}
+
+	// an app without its own policy gets the global one and the defaults
+	if global := runner.retrier(AppDetails{}); global.attempts != 5 || global.jitter != defaultRetryJitter || global.maxDelay != defaultRetryMaxDelay {
+		t.Errorf("unexpected global retrier %+v", global)
+	}
+}
@@ -0,0 +1,193 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// the statuses of a PhaseResult
+const (
+	StatusSucceeded     = "succeeded"
+	StatusFailed        = "failed"
+	StatusSkipped       = "skipped"
+	StatusNotApplicable = "not-applicable"
+)
+
+// failFastError ~ the cause of a run that FailFast stopped after a phase failed for an app
+type failFastError struct {
+	app string
+}
+
+func (err failFastError) Error() string {
+	return "stopped because " + err.app + " failed"
+}
+
+// newRun creates the state of a run of the given mode over the apps of the runner
+func newRun(runner *Runner, mode string) *Run {
+	return &Run{
+		Mode:    mode,
+		Apps:    runner.Config.Infrastructure,
+		Skipped: map[string]string{},
+		Resumed: map[string]PipelineRun{},
+		runner:  runner,
+	}
+}
+
+// IsCreate checks if the run creates the infrastructure
+func (r *Run) IsCreate() bool {
+	return r.Mode == ModeComplete || r.Mode == ModeCreate
+}
+
+// IsDeploy checks if the run creates and queues the pipelines
+func (r *Run) IsDeploy() bool {
+	return r.Mode == ModeComplete || r.Mode == ModeDeploy
+}
+
+// Applies checks if a phase of the mode works on an app. The swap phase only works on the apps with a deploy slot
+func (r *Run) Applies(phase string, app AppDetails) bool {
+	switch phase {
+	case PhaseAgent, PhasePipeline, PhaseQueue:
+		return r.IsDeploy()
+	case PhaseInfrastructure:
+		return r.IsCreate()
+	case PhaseSwap:
+		return (r.IsDeploy() || r.Mode == ModeSwap) && app.DeploySlot() != nil
+	}
+	return false
+}
+
+// execute runs every phase of the mode in order. A run that was interrupted or stopped by FailFast doesn't start
+// any further phase, and the phases that never started stay not applicable. Only a failure to prepare the agents stops the run early
+func (r *Run) execute(ctx context.Context) error {
+	ctx, r.stop = context.WithCancelCause(ctx)
+	defer r.stop(nil)
+
+	options := r.runner.Options
+	if options.Resume {
+		r.resume(ctx)
+	}
+
+	if r.IsDeploy() && ctx.Err() == nil {
+		prepareErr := r.runner.Agents.Prepare(ctx)
+		if prepareErr != nil && ctx.Err() == nil {
+			return prepareErr
+		}
+		if prepareErr == nil {
+			r.Agents = r.phase(ctx, PhaseAgent, options.phaseParallelism(options.AgentParallelism), r.agentWorker)
+		}
+	}
+
+	if r.IsCreate() && ctx.Err() == nil {
+		r.Infrastructure = r.phase(ctx, PhaseInfrastructure, options.phaseParallelism(options.InfraParallelism), r.infraWorker)
+	}
+
+	if r.IsDeploy() && ctx.Err() == nil {
+		r.Pipelines = r.phase(ctx, PhasePipeline, options.Parallelism, r.pipelineWorker)
+	}
+
+	if r.IsDeploy() && ctx.Err() == nil {
+		r.Queues = r.phase(ctx, PhaseQueue, options.phaseParallelism(options.QueueParallelism), r.queuePipelineWorker)
+	}
+
+	if (r.IsDeploy() || r.Mode == ModeSwap) && ctx.Err() == nil {
+		r.Swaps = r.phase(ctx, PhaseSwap, options.Parallelism, r.swapWorker)
+	}
+
+	return nil
+}
+
+// phase runs worker for every app, with at most limit workers at the same time. The results keep the order
+// of the apps, whatever order the workers finished in. Only the apps that the phase applies to are worked on.
+// Apps skipped by --resume are not handed to the worker, neither are the apps that are still waiting for a
+// worker once the run is interrupted or stopped by FailFast
+func (r *Run) phase(ctx context.Context, name string, limit int, worker func(context.Context, AppDetails) PhaseResult) []PhaseResult {
+	apps := []AppDetails{}
+	appNames := []string{}
+	for _, app := range r.Apps {
+		if r.Applies(name, app) {
+			apps = append(apps, app)
+			appNames = append(appNames, app.Name)
+		}
+	}
+	results := make([]PhaseResult, len(apps))
+	r.runner.emit(PhaseStarted{Phase: name, Apps: appNames})
+
+	var waitGroup sync.WaitGroup
+	pool := newWorkerPool(limit)
+	for i, appDetails := range apps {
+		index, app := i, appDetails
+
+		if reason, isSkipped := r.Skipped[app.Name]; isSkipped {
+			results[index] = PhaseResult{App: app.Name, Status: StatusSkipped, Reason: reason}
+			r.runner.emit(AppSkipped{Phase: name, App: app.Name, Reason: reason})
+			continue
+		}
+
+		waitGroup.Add(1)
+		pool.run(func() {
+			defer waitGroup.Done()
+
+			if ctx.Err() != nil {
+				results[index] = PhaseResult{App: app.Name, Status: StatusSkipped, Reason: stoppedReason(ctx)}
+				r.runner.emit(AppSkipped{Phase: name, App: app.Name, Reason: results[index].Reason})
+				return
+			}
+
+			start := time.Now()
+			result := worker(ctx, app)
+			result.App = app.Name
+			result.Duration = time.Since(start)
+			results[index] = result
+
+			if result.Status == StatusSkipped {
+				r.runner.emit(AppSkipped{Phase: name, App: app.Name, Reason: result.Reason})
+			}
+			if result.Status == StatusFailed && r.runner.Options.FailFast {
+				r.stop(failFastError{app: app.Name})
+			}
+		})
+	}
+	waitGroup.Wait()
+
+	r.runner.emit(PhaseFinished{Phase: name, Results: results})
+	return results
+}
+
+// stoppedReason tells why a run stopped before it worked on an app
+func stoppedReason(ctx context.Context) string {
+	var failFastErr failFastError
+	if errors.As(context.Cause(ctx), &failFastErr) {
+		return failFastErr.Error()
+	}
+	return "the run was interrupted"
+}
+
+// Result returns the result of an app in a phase. A phase that never worked on the app is not applicable to it
+func (r *Run) Result(results []PhaseResult, appName string) PhaseResult {
+	for _, result := range results {
+		if result.App == appName {
+			return result
+		}
+	}
+	return PhaseResult{App: appName, Status: StatusNotApplicable}
+}
+
+// succeeded checks if a phase succeeded for an app
+func (r *Run) succeeded(results []PhaseResult, appName string) bool {
+	return r.Result(results, appName).Status == StatusSucceeded
+}
+
+func succeededResult(resources ...string) PhaseResult {
+	return PhaseResult{Status: StatusSucceeded, Resources: resources}
+}
+
+// failedResult keeps the message that az printed instead of the exit status of a failed az command
+func failedResult(err error, resources ...string) PhaseResult {
+	return PhaseResult{Status: StatusFailed, Err: CommandError(err), Resources: resources}
+}
+
+func skippedResult(reason string) PhaseResult {
+	return PhaseResult{Status: StatusSkipped, Reason: reason}
+}
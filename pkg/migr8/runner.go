@@ -0,0 +1,95 @@
+// Package migr8 creates the Azure infrastructure of an application stack, creates its Azure DevOPS pipelines
+// and deploys every app with self hosted agents. A Runner works on a single InfraConfig and returns the
+// results of every run instead of exiting, so that migr8 can be embedded in other tools
+package migr8
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// the modes of a run
+const (
+	ModeCreate   = "create"
+	ModeDeploy   = "deploy"
+	ModeComplete = "complete"
+	ModeSwap     = "swap"
+)
+
+// ErrAborted is returned by Destroy when ConfirmDestroy declined the deletion
+var ErrAborted = errors.New("destroy aborted")
+
+// NewRunner creates a runner for a config that is already validated and interpolated, with the Azure, Azure
+// DevOPS and Docker backends. The state of the config is read from options.StatePath
+func NewRunner(config InfraConfig, options Options) (*Runner, error) {
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultPollInterval
+	}
+
+	state, stateErr := loadState(options.StatePath)
+	if stateErr != nil {
+		return nil, stateErr
+	}
+
+	runner := &Runner{
+		Config:      config,
+		Options:     options,
+		Provisioner: azureProvisioner{},
+		Pipelines:   azurePipelineService{},
+		state:       state,
+	}
+	runner.Agents = &dockerAgentRuntime{notify: runner.emit}
+	state.notify = runner.emit
+	return runner, nil
+}
+
+// Create creates the infrastructure of every app
+func (runner *Runner) Create(ctx context.Context) (*Run, error) {
+	return runner.run(ctx, ModeCreate)
+}
+
+// Deploy creates the pipeline of every app and queues it on a self hosted agent
+func (runner *Runner) Deploy(ctx context.Context) (*Run, error) {
+	return runner.run(ctx, ModeDeploy)
+}
+
+// Complete creates the infrastructure of every app and deploys it
+func (runner *Runner) Complete(ctx context.Context) (*Run, error) {
+	return runner.run(ctx, ModeComplete)
+}
+
+// Swap checks the health of the deploy slot of every app that has one and swaps it into production. Swapping
+// once more swaps the previous production back
+func (runner *Runner) Swap(ctx context.Context) (*Run, error) {
+	return runner.run(ctx, ModeSwap)
+}
+
+// run executes every phase of a mode and removes the agents afterwards. The error is only set when the run
+// couldn't start at all. Everything that failed for a single app is in the results of the run
+func (runner *Runner) run(ctx context.Context, mode string) (*Run, error) {
+	r := newRun(runner, mode)
+
+	r.StartedAt = time.Now().UTC()
+	runErr := r.execute(ctx)
+	if r.IsDeploy() {
+		cleanupErr := runner.Cleanup()
+		if cleanupErr != nil {
+			runner.diagnose(slog.LevelError, PhaseAgent, "", "failed to clean up the agents", cleanupErr)
+		}
+	}
+
+	r.FinishedAt = time.Now().UTC()
+	runner.emit(RunFinished{Run: r})
+	return r, runErr
+}
+
+// Cleanup removes everything that was started to run the pipelines, e.g. the agents. Deploy and Complete clean
+// up on their own, so it is only needed when a run is abandoned before it returned. It is safe to call while a
+// run cleans up, it waits for that cleanup and then removes whatever is left
+func (runner *Runner) Cleanup() error {
+	runner.cleanupMu.Lock()
+	defer runner.cleanupMu.Unlock()
+	return runner.Agents.Cleanup()
+}
@@ -0,0 +1,330 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testApps are a function app and a webapp that share a resource group
+func testApps() []AppDetails {
+	return []AppDetails{
+		{Type: "function", Name: "api", ResourceGroup: "rg", StorageAccount: "apisa", Location: "westeurope", Pipeline: Pipeline{Name: "api-pipeline", Project: "stack"}},
+		{Type: "webapp", Name: "web", ResourceGroup: "rg", AppServicePlan: "asp", Location: "westeurope", Pipeline: Pipeline{Name: "web-pipeline", Project: "stack"}},
+	}
+}
+
+// newTestRunner creates a runner on the fake that polls right away and doesn't retry
+func newTestRunner(t *testing.T, fake *fakeBackend, options Options) *Runner {
+	t.Helper()
+
+	options.StatePath = filepath.Join(t.TempDir(), "state.json")
+	options.PollInterval = time.Millisecond
+	attempts := 1
+	config := InfraConfig{DevOpsOrg: "https://dev.azure.com/org", Pat: "pat", AgentPool: "pool", Infrastructure: testApps(), Retry: &RetryPolicy{Attempts: &attempts}}
+
+	runner, err := NewRunner(config, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.useFakeBackend(fake)
+	return runner
+}
+
+// assertStatus fails unless the app has the given status in a phase
+func assertStatus(t *testing.T, run *Run, phase string, results []PhaseResult, app string, status string) PhaseResult {
+	t.Helper()
+
+	result := run.Result(results, app)
+	if result.Status != status {
+		t.Errorf("%s of %s is %s, want %s (err: %v, reason: %s)", phase, app, result.Status, status, result.Err, result.Reason)
+	}
+	return result
+}
+
+func TestCompleteCreatesAndDeploysEveryApp(t *testing.T) {
+	fake := newFakeBackend()
+	run, err := newTestRunner(t, fake, Options{}).Complete(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, app := range []string{"api", "web"} {
+		assertStatus(t, run, PhaseAgent, run.Agents, app, StatusSucceeded)
+		assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, app, StatusSucceeded)
+		assertStatus(t, run, PhasePipeline, run.Pipelines, app, StatusSucceeded)
+		assertStatus(t, run, PhaseQueue, run.Queues, app, StatusSucceeded)
+	}
+	for _, resource := range []string{"resource group/rg", "storage account/apisa", "function app/api", "app service plan/asp", "webapp/web", "pipeline/api-pipeline", "pipeline/web-pipeline"} {
+		if !fake.resources[resource] {
+			t.Errorf("%s was not created", resource)
+		}
+	}
+	if len(fake.agents) != 0 {
+		t.Errorf("the agents %v were not cleaned up", fake.agents)
+	}
+}
+
+func TestCreateReusesExistingResources(t *testing.T) {
+	fake := newFakeBackend("resource group/rg", "webapp/web")
+	run, err := newTestRunner(t, fake, Options{}).Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusSucceeded)
+	web := assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "web", StatusSucceeded)
+	assertStatus(t, run, PhaseQueue, run.Queues, "web", StatusNotApplicable)
+
+	// reused resources aren't reported as created, only the app service plan of the webapp is new
+	if len(web.Resources) != 1 || !strings.HasSuffix(web.Resources[0], "/serverfarms/asp") {
+		t.Errorf("web created %v, want only the app service plan", web.Resources)
+	}
+}
+
+func TestCreateFailsOnlyTheAppWhoseResourceFailed(t *testing.T) {
+	fake := newFakeBackend()
+	createErr := errors.New("quota exceeded")
+	fake.fail("CreateWebApp", "web", createErr)
+
+	run, err := newTestRunner(t, fake, Options{}).Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusSucceeded)
+	web := assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "web", StatusFailed)
+	if !errors.Is(web.Err, createErr) {
+		t.Errorf("web failed with %v, want %v", web.Err, createErr)
+	}
+	// the app service plan was created before the webapp failed
+	if !slices.ContainsFunc(web.Resources, func(id string) bool { return strings.HasSuffix(id, "/serverfarms/asp") }) {
+		t.Errorf("web reported %v as created, want the app service plan", web.Resources)
+	}
+}
+
+func TestCreateGrantsTheIdentitiesAccessToTheKeyVaults(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	api := &runner.Config.Infrastructure[0]
+	api.Slots = []Slot{{Name: "staging"}}
+	api.SettingsFrom = []SettingsSource{{KeyVault: "vault", Secrets: []KeyVaultSecret{{Name: "DB_PASSWORD", Secret: "db-password"}}}}
+	api.Settings = []AppSettings{{Name: "DB_PASSWORD", Value: keyVaultReference("vault", KeyVaultSecret{Secret: "db-password"})}}
+
+	run, err := runner.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusSucceeded)
+	for _, call := range []string{"GrantKeyVaultAccess/vault/principal-api", "GrantKeyVaultAccess/vault/principal-api/staging"} {
+		if !slices.Contains(fake.calls, call) {
+			t.Errorf("%s is missing from %v", call, fake.calls)
+		}
+	}
+	// web doesn't reference a vault, so it keeps running without an identity
+	if slices.Contains(fake.calls, "AssignIdentity/web") {
+		t.Errorf("web was assigned an identity")
+	}
+}
+
+func TestCreateGrantsAccessToTheKeyVaultsOfCopiedSettings(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	runner.Config.Infrastructure[0].SettingsFrom = []SettingsSource{{KeyVault: "vault", Secrets: []KeyVaultSecret{{Name: "DB_PASSWORD", Secret: "db-password"}}}}
+	runner.Config.Infrastructure[1].SettingsFrom = []SettingsSource{{App: "api"}}
+	if validationErrs := ResolveSettings(filepath.Join(t.TempDir(), "stack.json"), &runner.Config, nil); len(validationErrs) > 0 {
+		t.Fatal(validationErrs)
+	}
+
+	run, err := runner.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "web", StatusSucceeded)
+	for _, call := range []string{"AssignIdentity/web", "GrantKeyVaultAccess/vault/principal-web"} {
+		if !slices.Contains(fake.calls, call) {
+			t.Errorf("%s is missing from %v", call, fake.calls)
+		}
+	}
+}
+
+func TestCreateAppliesTheSettingsOfEverySlot(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	api := &runner.Config.Infrastructure[0]
+	api.Settings = []AppSettings{{Name: "DB_HOST", Value: "prod-db"}, {Name: "LOG_LEVEL", Value: "warn"}}
+	api.Slots = []Slot{{Name: "staging", Settings: []AppSettings{{Name: "DB_HOST", Value: "staging-db"}, {Name: "DEBUG", Value: "1"}}}, {Name: "qa"}}
+
+	run, err := runner.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusSucceeded)
+
+	// an overridden setting is sticky everywhere, the others follow the swap
+	want := map[string][]AppSettings{
+		"api":         {{Name: "DB_HOST", Value: "prod-db", SlotSetting: true}, {Name: "LOG_LEVEL", Value: "warn"}},
+		"api/staging": {{Name: "LOG_LEVEL", Value: "warn"}, {Name: "DB_HOST", Value: "staging-db", SlotSetting: true}, {Name: "DEBUG", Value: "1", SlotSetting: true}},
+		"api/qa":      {{Name: "DB_HOST", Value: "prod-db", SlotSetting: true}, {Name: "LOG_LEVEL", Value: "warn"}},
+	}
+	for target, settings := range want {
+		if !slices.Equal(fake.settings[target], settings) {
+			t.Errorf("the settings of %s are %v, want %v", target, fake.settings[target], settings)
+		}
+	}
+}
+
+func TestCompleteSkipsTheDeploymentOfFailedInfrastructure(t *testing.T) {
+	fake := newFakeBackend()
+	fake.fail("CreateFunctionApp", "api", errors.New("name taken"))
+
+	run, err := newTestRunner(t, fake, Options{}).Complete(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusFailed)
+	assertStatus(t, run, PhasePipeline, run.Pipelines, "api", StatusSkipped)
+	assertStatus(t, run, PhaseQueue, run.Queues, "api", StatusSkipped)
+	assertStatus(t, run, PhaseQueue, run.Queues, "web", StatusSucceeded)
+}
+
+func TestDeployFailsTheAppsWhoseRunFailed(t *testing.T) {
+	fake := newFakeBackend()
+	fake.runResult = "failed"
+
+	run, err := newTestRunner(t, fake, Options{}).Deploy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusNotApplicable)
+	for _, app := range []string{"api", "web"} {
+		result := assertStatus(t, run, PhaseQueue, run.Queues, app, StatusFailed)
+		if len(result.Resources) != 1 {
+			t.Errorf("the run of %s is missing from %v", app, result.Resources)
+		}
+	}
+}
+
+func TestDeployDoesNotRetryQueueing(t *testing.T) {
+	fake := newFakeBackend()
+	fake.fail("QueuePipeline", "web-pipeline", errors.New("(ServiceUnavailable) Service Unavailable"))
+
+	runner := newTestRunner(t, fake, Options{})
+	attempts := 3
+	runner.Config.Retry = &RetryPolicy{Attempts: &attempts, BaseDelay: "1ms", MaxDelay: "1ms"}
+	run, err := runner.Deploy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseQueue, run.Queues, "web", StatusFailed)
+	if queued := slices.Index(fake.calls, "QueuePipeline/web-pipeline"); queued == -1 || slices.Contains(fake.calls[queued+1:], "QueuePipeline/web-pipeline") {
+		t.Errorf("web-pipeline wasn't queued exactly once: %v", fake.calls)
+	}
+}
+
+func TestDeploySkipsTheQueueWhenTheAgentFailed(t *testing.T) {
+	fake := newFakeBackend()
+	fake.fail("StartAgent", "web_deployment_agent", errors.New("docker is not running"))
+
+	run, err := newTestRunner(t, fake, Options{}).Deploy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseAgent, run.Agents, "web", StatusFailed)
+	assertStatus(t, run, PhasePipeline, run.Pipelines, "web", StatusSucceeded)
+	queue := assertStatus(t, run, PhaseQueue, run.Queues, "web", StatusSkipped)
+	if queue.Reason != "the agent was not started" {
+		t.Errorf("the queue of web was skipped because %q", queue.Reason)
+	}
+	assertStatus(t, run, PhaseQueue, run.Queues, "api", StatusSucceeded)
+}
+
+func TestFailFastStopsTheRun(t *testing.T) {
+	fake := newFakeBackend()
+	fake.fail("StartAgent", "api_deployment_agent", errors.New("docker is not running"))
+
+	run, err := newTestRunner(t, fake, Options{Parallelism: 1, FailFast: true}).Complete(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatus(t, run, PhaseAgent, run.Agents, "api", StatusFailed)
+	// web either started its agent before api failed or was still waiting for the worker
+	web := run.Result(run.Agents, "web")
+	if web.Status == StatusSkipped && web.Reason != "stopped because api failed" {
+		t.Errorf("the agent of web was skipped because %q", web.Reason)
+	}
+	// no further phase starts once the run was stopped
+	for _, app := range []string{"api", "web"} {
+		assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, app, StatusNotApplicable)
+		assertStatus(t, run, PhaseQueue, run.Queues, app, StatusNotApplicable)
+	}
+	if len(fake.agents) != 0 {
+		t.Errorf("the agents %v were not cleaned up", fake.agents)
+	}
+}
+
+func TestCreateFailsWhenAResourceCantBeLookedUp(t *testing.T) {
+	fake := newFakeBackend()
+	fake.fail("StorageAccountExists", "apisa", errors.New("AuthorizationFailed"))
+	runner := newTestRunner(t, fake, Options{})
+
+	run, err := runner.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, run, PhaseInfrastructure, run.Infrastructure, "api", StatusFailed)
+	// a resource that might exist is neither created nor claimed
+	if slices.Contains(fake.calls, "CreateStorageAccount/apisa") {
+		t.Errorf("the storage account was created after its lookup failed")
+	}
+}
+
+// overlapRuntime ~ an AgentRuntime whose Cleanup takes a while and counts the calls that overlapped
+type overlapRuntime struct {
+	*fakeBackend
+	running  atomic.Int32
+	overlaps atomic.Int32
+}
+
+func (runtime *overlapRuntime) Cleanup() error {
+	if runtime.running.Add(1) > 1 {
+		runtime.overlaps.Add(1)
+	}
+	defer runtime.running.Add(-1)
+	time.Sleep(10 * time.Millisecond)
+	return runtime.fakeBackend.Cleanup()
+}
+
+func TestCleanupWaitsForARunningCleanup(t *testing.T) {
+	fake := newFakeBackend()
+	runner := newTestRunner(t, fake, Options{})
+	runtime := &overlapRuntime{fakeBackend: fake}
+	runner.Agents = runtime
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			runner.Cleanup()
+		}()
+	}
+	waitGroup.Wait()
+
+	if overlaps := runtime.overlaps.Load(); overlaps > 0 {
+		t.Errorf("%d cleanups ran at the same time", overlaps)
+	}
+}
@@ -0,0 +1,62 @@
+package migr8
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SelectApps narrows apps down to the ones named in onlyApps, minus the ones named in skipApps, whose labels match
+// every selector, e.g. tier=frontend,region!=us. Empty lists don't narrow anything
+func SelectApps(apps []AppDetails, onlyApps []string, skipApps []string, selectors []string) ([]AppDetails, error) {
+	for _, name := range append(slices.Clone(onlyApps), skipApps...) {
+		isKnown := slices.ContainsFunc(apps, func(app AppDetails) bool { return app.Name == name })
+		if !isKnown {
+			return nil, fmt.Errorf("unknown app %s", name)
+		}
+	}
+
+	selected := []AppDetails{}
+	for _, app := range apps {
+		if len(onlyApps) > 0 && !slices.Contains(onlyApps, app.Name) {
+			continue
+		}
+		if slices.Contains(skipApps, app.Name) {
+			continue
+		}
+
+		isMatch, err := matchLabels(app.Labels, selectors)
+		if err != nil {
+			return nil, err
+		}
+		if isMatch {
+			selected = append(selected, app)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no app matches the selection")
+	}
+	return selected, nil
+}
+
+// matchLabels checks if labels satisfy every key=value and key!=value selector
+func matchLabels(labels map[string]string, selectors []string) (bool, error) {
+	for _, selector := range selectors {
+		key, value, isNegated := strings.Cut(selector, "!=")
+		if !isNegated {
+			var isPair bool
+			key, value, isPair = strings.Cut(selector, "=")
+			if !isPair {
+				return false, fmt.Errorf("selector %q is not in the form key=value or key!=value", selector)
+			}
+		}
+
+		label, hasLabel := labels[strings.TrimSpace(key)]
+		isEqual := hasLabel && label == strings.TrimSpace(value)
+		if isEqual == isNegated {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,264 @@
+package migr8
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// the ways the settings of an app are applied. Only webapps can pass them to the pipeline as parameters
+const (
+	SettingsModeApp      = "app"
+	SettingsModePipeline = "pipeline"
+)
+
+// SettingsModes are the values of settingsMode
+var SettingsModes = []string{SettingsModeApp, SettingsModePipeline}
+
+// the statuses of a SettingsDiff, besides StatusSkipped and StatusFailed
+const (
+	SettingsInSync  = "in-sync"
+	SettingsDrifted = "drifted"
+	SettingsSynced  = "synced"
+)
+
+// platformSettingPrefixes are the settings that Azure and the deployments manage on every app. They are never
+// reported or pruned unless the config declares them
+var platformSettingPrefixes = []string{
+	"APPINSIGHTS_", "APPLICATIONINSIGHTS_", "AzureWebJobs", "DIAGNOSTICS_", "FUNCTIONS_", "SCM_", "WEBSITE_", "WEBSITES_",
+}
+
+// SettingsAsParameters checks if the settings of the app are passed to its pipeline as queue-time parameters
+// instead of being set as app settings, e.g. for variables that a frontend needs at build time
+func (app AppDetails) SettingsAsParameters() bool {
+	return app.Type == "webapp" && app.SettingsMode == SettingsModePipeline
+}
+
+// setAppSettings adds or updates settings of an app or of one of its slots. Settings with slotSetting are marked as
+// slot settings, so that they stay with the slot when slots are swapped. The settings are handed to az in a JSON
+// file that only the current user can read, so that their values never show up in the process list
+func setAppSettings(ctx context.Context, app AppDetails, slot string, settings []AppSettings) error {
+	file, err := writeSettingsFile(settings)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+
+	args := []string{azAppKind(app), "config", "appsettings", "set", "--name", app.Name, "--resource-group", app.ResourceGroup, "--settings", "@" + file}
+	if slot != "" {
+		args = append(args, "--slot", slot)
+	}
+	return azRun(ctx, args...)
+}
+
+// writeSettingsFile writes settings to a temporary file in the JSON form that az prints and reads, with
+// owner-only permissions. The caller removes the file
+func writeSettingsFile(settings []AppSettings) (string, error) {
+	content, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+
+	// CreateTemp already creates the file with 0600, the chmod makes sure of it before anything is written
+	file, err := os.CreateTemp("", "migr8-settings-*.json")
+	if err != nil {
+		return "", err
+	}
+	chmodErr := file.Chmod(0o600)
+	var writeErr error
+	if chmodErr == nil {
+		_, writeErr = file.Write(content)
+	}
+	if err := errors.Join(chmodErr, writeErr, file.Close()); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// appSettings returns the live settings of an app or of one of its slots
+func appSettings(ctx context.Context, app AppDetails, slot string) ([]AppSettings, error) {
+	args := []string{azAppKind(app), "config", "appsettings", "list", "--name", app.Name, "--resource-group", app.ResourceGroup}
+	if slot != "" {
+		args = append(args, "--slot", slot)
+	}
+	return azQuery[[]AppSettings](ctx, args...)
+}
+
+// deleteAppSettings deletes the named settings of an app or of one of its slots
+func deleteAppSettings(ctx context.Context, app AppDetails, slot string, names []string) error {
+	args := []string{azAppKind(app), "config", "appsettings", "delete", "--name", app.Name, "--resource-group", app.ResourceGroup}
+	if slot != "" {
+		args = append(args, "--slot", slot)
+	}
+	return azRun(ctx, append(append(args, "--setting-names"), names...)...)
+}
+
+// DiffSettings compares the settings of every app, and of each of its slots, with the live app settings. Nothing
+// is changed. Webapps that pass their settings as pipeline parameters are skipped
+func (runner *Runner) DiffSettings(ctx context.Context) []SettingsDiff {
+	diffs := []SettingsDiff{}
+
+	for _, app := range runner.Config.Infrastructure {
+		if app.SettingsAsParameters() {
+			diffs = append(diffs, SettingsDiff{App: app.Name, Changes: []SettingChange{}, Status: StatusSkipped, Note: "the settings are passed to the pipeline as parameters"})
+			continue
+		}
+
+		runner.diagnose(slog.LevelInfo, PhaseSettings, app.Name, "looking up app settings", nil)
+		diffs = append(diffs, runner.diffSettings(ctx, app, ""))
+		for _, slot := range app.Slots {
+			diffs = append(diffs, runner.diffSettings(ctx, app, slot.Name))
+		}
+	}
+
+	return diffs
+}
+
+// diffSettings compares the settings of an app, or of one of its slots, with the live app settings
+func (runner *Runner) diffSettings(ctx context.Context, app AppDetails, slot string) SettingsDiff {
+	diff := SettingsDiff{App: app.Name, Slot: slot, Changes: []SettingChange{}}
+	target := strings.TrimSuffix(app.Name+"/"+slot, "/")
+
+	live, err := withRetry(ctx, runner.retrier(app), "get app settings "+target, func() ([]AppSettings, error) {
+		return runner.Provisioner.AppSettings(ctx, app, slot)
+	})
+	if err != nil {
+		runner.diagnose(slog.LevelError, PhaseSettings, app.Name, "failed to look up the app settings of "+target, err)
+		diff.Status = StatusFailed
+		diff.Error = err.Error()
+		return diff
+	}
+
+	diff.Changes = compareSettings(app.SlotSettings(slot), live)
+	diff.Status = SettingsInSync
+	if len(diff.Changes) > 0 {
+		diff.Status = SettingsDrifted
+	}
+	return diff
+}
+
+// compareSettings returns the settings that have to be added, changed or removed for the live settings to match
+// the declared ones, sorted by name. A setting changes when its value or its slotSetting flag differs
+func compareSettings(declared []AppSettings, live []AppSettings) []SettingChange {
+	changes := []SettingChange{}
+
+	liveSettings := map[string]AppSettings{}
+	for _, setting := range live {
+		liveSettings[setting.Name] = setting
+	}
+
+	isDeclared := map[string]bool{}
+	for _, setting := range declared {
+		isDeclared[setting.Name] = true
+		current, isFound := liveSettings[setting.Name]
+		if !isFound {
+			changes = append(changes, SettingChange{Name: setting.Name, Action: "add", Declared: setting.Value, SlotSetting: setting.SlotSetting})
+			continue
+		}
+		if current.Value != setting.Value || current.SlotSetting != setting.SlotSetting {
+			changes = append(changes, SettingChange{Name: setting.Name, Action: "change", Live: current.Value, Declared: setting.Value,
+				LiveSlotSetting: current.SlotSetting, SlotSetting: setting.SlotSetting})
+		}
+	}
+
+	for _, setting := range live {
+		if isDeclared[setting.Name] || isPlatformSetting(setting.Name) {
+			continue
+		}
+		changes = append(changes, SettingChange{Name: setting.Name, Action: "remove", Live: setting.Value, LiveSlotSetting: setting.SlotSetting})
+	}
+
+	slices.SortFunc(changes, func(a SettingChange, b SettingChange) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// isPlatformSetting checks if a setting is managed by Azure or by the deployments rather than by the config
+func isPlatformSetting(name string) bool {
+	return slices.ContainsFunc(platformSettingPrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) })
+}
+
+// SyncSettings makes the live app settings match the config, for the diffs that DiffSettings returned. Only the
+// added and changed settings are set, with their declared value and slotSetting flag. With prune the live settings that the config doesn't declare are deleted, without it
+// they are kept. Diffs that aren't drifted are returned as they are
+func (runner *Runner) SyncSettings(ctx context.Context, diffs []SettingsDiff, prune bool) []SettingsDiff {
+	apps := map[string]AppDetails{}
+	for _, app := range runner.Config.Infrastructure {
+		apps[app.Name] = app
+	}
+
+	results := make([]SettingsDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		app, isFound := apps[diff.App]
+		if !isFound || diff.Status != SettingsDrifted {
+			results = append(results, diff)
+			continue
+		}
+		results = append(results, runner.syncSettings(ctx, app, diff, prune))
+	}
+
+	return results
+}
+
+// syncSettings applies a single drifted diff to an app or to one of its slots
+func (runner *Runner) syncSettings(ctx context.Context, app AppDetails, diff SettingsDiff, prune bool) SettingsDiff {
+	retry := runner.retrier(app)
+	target := strings.TrimSuffix(app.Name+"/"+diff.Slot, "/")
+
+	removed := []string{}
+	changed := []string{}
+	for _, change := range diff.Changes {
+		if change.Action == "remove" {
+			removed = append(removed, change.Name)
+			continue
+		}
+		changed = append(changed, change.Name)
+	}
+	settings := slices.DeleteFunc(app.SlotSettings(diff.Slot), func(setting AppSettings) bool { return !slices.Contains(changed, setting.Name) })
+	isSet := len(settings) > 0
+
+	fail := func(message string, err error) SettingsDiff {
+		runner.diagnose(slog.LevelError, PhaseSettings, app.Name, message+target, err)
+		diff.Status = StatusFailed
+		diff.Error = err.Error()
+		return diff
+	}
+
+	if isSet {
+		if accessErr := runner.grantKeyVaultAccess(ctx, PhaseSettings, app, diff.Slot); accessErr != nil {
+			return fail("failed to grant key vault access to ", accessErr)
+		}
+		runner.diagnose(slog.LevelInfo, PhaseSettings, app.Name, fmt.Sprintf("setting %d app settings of %s", len(settings), target), nil)
+		setErr := retryCall(ctx, retry, "set app settings "+target, func() error {
+			return runner.Provisioner.SetAppSettings(ctx, app, diff.Slot, settings)
+		})
+		if setErr != nil {
+			return fail("failed to set the app settings of ", setErr)
+		}
+	}
+
+	if len(removed) > 0 && !prune {
+		diff.Note = fmt.Sprintf("%d undeclared settings were kept", len(removed))
+		if !isSet {
+			return diff
+		}
+	}
+
+	if len(removed) > 0 && prune {
+		runner.diagnose(slog.LevelInfo, PhaseSettings, app.Name, fmt.Sprintf("deleting %d undeclared app settings of %s", len(removed), target), nil)
+		deleteErr := retryCall(ctx, retry, "delete app settings "+target, func() error {
+			return runner.Provisioner.DeleteAppSettings(ctx, app, diff.Slot, removed)
+		})
+		if deleteErr != nil {
+			return fail("failed to delete the app settings of ", deleteErr)
+		}
+	}
+
+	diff.Status = SettingsSynced
+	return diff
+}
@@ -0,0 +1,80 @@
+package migr8
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestWriteSettingsFileIsOwnerOnly(t *testing.T) {
+	settings := []AppSettings{{Name: "DB_PASSWORD", Value: "s3cr=t \"quoted\""}, {Name: "DB_HOST", Value: "db", SlotSetting: true}}
+
+	file, err := writeSettingsFile(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("the settings file has the permissions %s, want -rw-------", info.Mode().Perm())
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := []AppSettings{}
+	if err := json.Unmarshal(content, &written); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(written, settings) {
+		t.Errorf("the settings file holds %v, want %v", written, settings)
+	}
+}
+
+func TestCompareSettingsReportsTheSlotSettingFlag(t *testing.T) {
+	declared := []AppSettings{{Name: "DB_HOST", Value: "db", SlotSetting: true}, {Name: "LOG_LEVEL", Value: "warn"}, {Name: "MODE", Value: "prod"}}
+	live := []AppSettings{{Name: "DB_HOST", Value: "db"}, {Name: "LOG_LEVEL", Value: "warn", SlotSetting: true}, {Name: "MODE", Value: "prod"}}
+
+	want := []SettingChange{
+		{Name: "DB_HOST", Action: "change", Live: "db", Declared: "db", SlotSetting: true},
+		{Name: "LOG_LEVEL", Action: "change", Live: "warn", Declared: "warn", LiveSlotSetting: true},
+	}
+	if changes := compareSettings(declared, live); !slices.Equal(changes, want) {
+		t.Errorf("the changes are %v, want %v", changes, want)
+	}
+}
+
+func TestSyncSettingsOnlySetsTheAddedAndChangedSettings(t *testing.T) {
+	fake := newFakeBackend()
+	fake.settings["api"] = []AppSettings{{Name: "DB_HOST", Value: "db"}, {Name: "LOG_LEVEL", Value: "debug"}, {Name: "MODE", Value: "prod"}, {Name: "OLD", Value: "1"}}
+	runner := newTestRunner(t, fake, Options{})
+	runner.Config.Infrastructure = runner.Config.Infrastructure[:1]
+	runner.Config.Infrastructure[0].Settings = []AppSettings{
+		{Name: "DB_HOST", Value: "db", SlotSetting: true}, {Name: "LOG_LEVEL", Value: "warn"}, {Name: "MODE", Value: "prod"}, {Name: "NEW", Value: "1"},
+	}
+
+	diffs := runner.DiffSettings(context.Background())
+	if len(diffs) != 1 || diffs[0].Status != SettingsDrifted {
+		t.Fatalf("the diffs are %v, want api drifted", diffs)
+	}
+
+	results := runner.SyncSettings(context.Background(), diffs, false)
+	if results[0].Status != SettingsSynced {
+		t.Fatalf("api is %s, want %s (err: %s)", results[0].Status, SettingsSynced, results[0].Error)
+	}
+	// MODE is in sync, so it isn't set again, and OLD is kept without --prune
+	if want := [][]string{{"DB_HOST", "LOG_LEVEL", "NEW"}}; !slices.EqualFunc(fake.set["api"], want, slices.Equal[[]string]) {
+		t.Errorf("the sync set %v, want %v", fake.set["api"], want)
+	}
+	if changes := runner.DiffSettings(context.Background())[0].Changes; len(changes) != 1 || changes[0].Name != "OLD" {
+		t.Errorf("the changes after the sync are %v, want only OLD", changes)
+	}
+}
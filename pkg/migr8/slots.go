@@ -0,0 +1,140 @@
+package migr8
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// the defaults of the health check of a slot before it is swapped. A single probe that takes longer than
+// healthCheckProbeTimeout fails and is repeated on the next poll
+const (
+	defaultHealthCheckPath    = "/"
+	defaultHealthCheckTimeout = 5 * time.Minute
+	healthCheckProbeTimeout   = 30 * time.Second
+)
+
+// healthCheckClient requests the health check paths. A slot that accepts the connection but never answers fails
+// the probe instead of holding up the swap phase
+var healthCheckClient = &http.Client{Timeout: healthCheckProbeTimeout}
+
+// SlotNamePattern is the naming rule of deployment slots. production is the app itself and can't be a slot
+const SlotNamePattern = `^[a-zA-Z0-9-]+$`
+
+// DeploySlot returns the slot that the pipeline of the app deploys to, or nil if it deploys to production
+func (app AppDetails) DeploySlot() *Slot {
+	for i := range app.Slots {
+		if app.Slots[i].Deploy {
+			return &app.Slots[i]
+		}
+	}
+	return nil
+}
+
+// SlotSettings returns the settings of the app on production, or on one of its slots. A slot gets the settings
+// of the app with its own settings on top. Azure keeps the slotSetting flag per setting name for the app and all of
+// its slots, so a setting that any slot declares is a slot setting everywhere and stays put when slots are swapped
+func (app AppDetails) SlotSettings(slot string) []AppSettings {
+	isSticky := map[string]bool{}
+	own := []AppSettings{}
+	for _, s := range app.Slots {
+		for _, setting := range s.Settings {
+			isSticky[setting.Name] = true
+		}
+		if slot != "" && s.Name == slot {
+			own = s.Settings
+		}
+	}
+
+	settings := make([]AppSettings, 0, len(app.Settings)+len(own))
+	for _, setting := range app.Settings {
+		if slices.ContainsFunc(own, func(override AppSettings) bool { return override.Name == setting.Name }) {
+			continue
+		}
+		setting.SlotSetting = setting.SlotSetting || isSticky[setting.Name]
+		settings = append(settings, setting)
+	}
+	for _, setting := range own {
+		setting.SlotSetting = true
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// healthCheckPath returns the path that is requested on the slot, with a leading slash
+func (slot Slot) healthCheckPath() string {
+	if slot.HealthCheckPath == "" {
+		return defaultHealthCheckPath
+	}
+	return slot.HealthCheckPath
+}
+
+// healthCheckTimeout returns how long the slot may take to become healthy. The config is validated beforehand
+func (slot Slot) healthCheckTimeout() time.Duration {
+	timeout, err := time.ParseDuration(slot.HealthCheckTimeout)
+	if err != nil || timeout <= 0 {
+		return defaultHealthCheckTimeout
+	}
+	return timeout
+}
+
+// azAppKind returns the az command group of an app, functionapp or webapp
+func azAppKind(app AppDetails) string {
+	if app.Type == "function" {
+		return "functionapp"
+	}
+	return "webapp"
+}
+
+// slotExists checks if an app has a deployment slot
+func slotExists(ctx context.Context, app AppDetails, slot string) (bool, error) {
+	names, err := azQuery[[]string](ctx, azAppKind(app), "deployment", "slot", "list", "--name", app.Name, "--resource-group", app.ResourceGroup, "--query", "[].name")
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(names, slot), nil
+}
+
+// createSlot creates a deployment slot with the configuration of the app, unless it already exists
+func createSlot(ctx context.Context, app AppDetails, slot string) error {
+	isFound, err := slotExists(ctx, app, slot)
+	if err != nil || isFound {
+		return err
+	}
+	return azRun(ctx, azAppKind(app), "deployment", "slot", "create", "--name", app.Name, "--resource-group", app.ResourceGroup, "--slot", slot, "--configuration-source", app.Name)
+}
+
+// swapSlot swaps a deployment slot with production. The settings with slotSetting stay where they are
+func swapSlot(ctx context.Context, app AppDetails, slot string) error {
+	return azRun(ctx, azAppKind(app), "deployment", "slot", "swap", "--name", app.Name, "--resource-group", app.ResourceGroup, "--slot", slot, "--target-slot", "production")
+}
+
+// checkSlotHealth requests the health check path on the host name of a slot
+func checkSlotHealth(ctx context.Context, app AppDetails, slot Slot) error {
+	host, err := azQuery[string](ctx, azAppKind(app), "show", "--name", app.Name, "--resource-group", app.ResourceGroup, "--slot", slot.Name, "--query", "defaultHostName")
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("slot %s has no host name", slot.Name)
+	}
+
+	url := "https://" + host + "/" + strings.TrimPrefix(slot.healthCheckPath(), "/")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := healthCheckClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+	return nil
+}
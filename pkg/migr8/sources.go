@@ -0,0 +1,243 @@
+package migr8
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the naming rules of the settings read from .env files and Key Vaults, of Key Vaults and of Key Vault secrets.
+// Inline settings aren't held to SettingNamePattern, so that names that az accepts keep working
+const (
+	SettingNamePattern    = `^[a-zA-Z0-9_.:-]+$`
+	KeyVaultNamePattern   = `^[a-zA-Z][a-zA-Z0-9-]{1,22}[a-zA-Z0-9]$`
+	KeyVaultSecretPattern = `^[a-zA-Z0-9-]{1,127}$`
+)
+
+var (
+	settingName    = regexp.MustCompile(SettingNamePattern)
+	keyVaultName   = regexp.MustCompile(KeyVaultNamePattern)
+	keyVaultSecret = regexp.MustCompile(KeyVaultSecretPattern)
+)
+
+// settingsResolver ~ merges the sources of every app of a config. An app is resolved once, even when other apps
+// copy its settings
+type settingsResolver struct {
+	baseDir        string
+	lookup         func(string) (string, bool)
+	apps           []AppDetails
+	indexes        map[string]int
+	resolved       map[int][]AppSettings
+	resolving      map[int]bool
+	validationErrs []ValidationError
+}
+
+// ResolveSettings merges the settings of the settingsFrom sources of every app of a config that was read from path
+// into its settings. Sources are merged in order, so a later source overrides an earlier one, and the inline
+// settings override every source. The placeholders of .env values are interpolated with the KEY=VALUE pairs and the
+// environment, like InterpolateConfig does for the config, which has to run first. Files that can't be read, invalid
+// setting names, missing variables and apps that copy each other's settings are returned as errors. The merged
+// settings are checked by CheckConfig
+func ResolveSettings(path string, config *InfraConfig, pairs []string) []ValidationError {
+	// a pair that isn't KEY=VALUE is already reported by InterpolateConfig
+	lookup, pairErr := variables(pairs)
+	if pairErr != nil {
+		return nil
+	}
+
+	resolver := &settingsResolver{
+		baseDir:   filepath.Dir(path),
+		lookup:    lookup,
+		apps:      config.Infrastructure,
+		indexes:   map[string]int{},
+		resolved:  map[int][]AppSettings{},
+		resolving: map[int]bool{},
+	}
+	for i, app := range config.Infrastructure {
+		if _, isDuplicate := resolver.indexes[app.Name]; !isDuplicate {
+			resolver.indexes[app.Name] = i
+		}
+	}
+
+	// the settings are replaced once every app is resolved, because resolve reads the inline settings of the apps
+	merged := make([][]AppSettings, len(config.Infrastructure))
+	for i := range config.Infrastructure {
+		merged[i] = resolver.resolve(i)
+	}
+	for i := range config.Infrastructure {
+		config.Infrastructure[i].Settings = merged[i]
+	}
+
+	return resolver.validationErrs
+}
+
+// resolve returns the inline settings of an app followed by the settings of its sources that it doesn't declare
+func (resolver *settingsResolver) resolve(index int) []AppSettings {
+	if settings, isResolved := resolver.resolved[index]; isResolved {
+		return settings
+	}
+	app := resolver.apps[index]
+	if len(app.SettingsFrom) == 0 {
+		return app.Settings
+	}
+
+	resolver.resolving[index] = true
+	defer delete(resolver.resolving, index)
+
+	merged := []AppSettings{}
+	for i, source := range app.SettingsFrom {
+		for _, setting := range resolver.readSource(fmt.Sprintf("infrastructure[%d].settingsFrom[%d]", index, i), index, source) {
+			setting.SlotSetting = setting.SlotSetting || source.SlotSetting
+			merged = mergeSetting(merged, setting)
+		}
+	}
+
+	// the inline settings go first and keep their index, so that the errors of CheckConfig point at them
+	settings := slices.Clone(app.Settings)
+	for _, setting := range merged {
+		if !slices.ContainsFunc(app.Settings, func(inline AppSettings) bool { return inline.Name == setting.Name }) {
+			settings = append(settings, setting)
+		}
+	}
+
+	resolver.resolved[index] = settings
+	return settings
+}
+
+// readSource returns the settings of a single source of the app at index self. Sources that are set up wrong,
+// e.g. with an unknown app or the app itself, are left to CheckConfig
+func (resolver *settingsResolver) readSource(path string, self int, source SettingsSource) []AppSettings {
+	switch {
+	case source.EnvFile != "":
+		file := source.EnvFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(resolver.baseDir, file)
+		}
+		settings, validationErrs := readEnvFile(path+".envFile", file, resolver.lookup)
+		resolver.validationErrs = append(resolver.validationErrs, validationErrs...)
+		return settings
+
+	case source.App != "":
+		index, isFound := resolver.indexes[source.App]
+		if !isFound || index == self {
+			return nil
+		}
+		if resolver.resolving[index] {
+			resolver.validationErrs = append(resolver.validationErrs, ValidationError{path + ".app", fmt.Sprintf("%q copies the settings back. Apps can't copy each other's settings", source.App)})
+			return nil
+		}
+		return resolver.resolve(index)
+
+	case source.KeyVault != "":
+		settings := []AppSettings{}
+		for i, secret := range source.Secrets {
+			if !settingName.MatchString(secret.Name) {
+				resolver.validationErrs = append(resolver.validationErrs, ValidationError{fmt.Sprintf("%s.secrets[%d].name", path, i), describeSettingName(secret.Name)})
+				continue
+			}
+			settings = append(settings, AppSettings{Name: secret.Name, Value: keyVaultReference(source.KeyVault, secret)})
+		}
+		return settings
+	}
+
+	return nil
+}
+
+// mergeSetting adds a setting to settings, or replaces the value of the setting with the same name
+func mergeSetting(settings []AppSettings, setting AppSettings) []AppSettings {
+	index := slices.IndexFunc(settings, func(merged AppSettings) bool { return merged.Name == setting.Name })
+	if index == -1 {
+		return append(settings, setting)
+	}
+	settings[index] = setting
+	return settings
+}
+
+// keyVaultReference returns the app setting value that makes an app read a secret from a Key Vault
+func keyVaultReference(vault string, secret KeyVaultSecret) string {
+	reference := "VaultName=" + vault + ";SecretName=" + secret.Secret
+	if secret.Version != "" {
+		reference += ";SecretVersion=" + secret.Version
+	}
+	return "@Microsoft.KeyVault(" + reference + ")"
+}
+
+// readEnvFile reads the KEY=VALUE lines of a .env file. Blank lines, # comments and an export prefix are ignored.
+// Double quoted values can contain escapes like \n, single quoted values are taken as they are and unquoted values
+// end at a # comment. The placeholders of double quoted and unquoted values are interpolated with lookup. A key
+// that appears twice keeps its last value
+func readEnvFile(path string, file string, lookup func(string) (string, bool)) ([]AppSettings, []ValidationError) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, []ValidationError{{path, err.Error()}}
+	}
+
+	settings := []AppSettings{}
+	validationErrs := []ValidationError{}
+	problem := func(line int, message string) {
+		validationErrs = append(validationErrs, ValidationError{path, fmt.Sprintf("%s:%d: %s", file, line, message)})
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, isPair := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !isPair {
+			problem(line, "expected KEY=VALUE")
+			continue
+		}
+		if !settingName.MatchString(key) {
+			problem(line, describeSettingName(key))
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				problem(line, fmt.Sprintf("%s has an invalid quoted value", key))
+				continue
+			}
+			value = interpolateEnvValue(unquoted, lookup, func(message string) { problem(line, message) })
+		case len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+			value = value[1 : len(value)-1]
+		default:
+			if comment := strings.Index(value, " #"); comment != -1 {
+				value = strings.TrimSpace(value[:comment])
+			}
+			value = interpolateEnvValue(value, lookup, func(message string) { problem(line, message) })
+		}
+
+		settings = mergeSetting(settings, AppSettings{Name: key, Value: value})
+	}
+
+	return settings, validationErrs
+}
+
+// interpolateEnvValue replaces the placeholders of a .env value and reports every variable without a value
+func interpolateEnvValue(value string, lookup func(string) (string, bool), problem func(message string)) string {
+	interpolated, missing := interpolate(value, lookup)
+	for _, name := range missing {
+		problem(describeMissingVariable(name))
+	}
+	return interpolated
+}
+
+// describeSettingName explains the naming rule of app settings
+func describeSettingName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return "is required"
+	}
+	return fmt.Sprintf("%q must be letters, numbers, underscores, periods, colons and hyphens", name)
+}
@@ -0,0 +1,84 @@
+package migr8
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSettingsInterpolatesEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	env := "API_URL=https://${ENV}.example.com\nQUOTED=\"${ENV}-db\"\nLITERAL='${ENV}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "api.env"), []byte(env), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := InfraConfig{Infrastructure: []AppDetails{
+		{Name: "api", SettingsFrom: []SettingsSource{{EnvFile: "api.env"}}},
+		{Name: "web", SettingsFrom: []SettingsSource{{App: "api"}}},
+	}}
+	if validationErrs := ResolveSettings(filepath.Join(dir, "stack.json"), &config, []string{"ENV=prod"}); len(validationErrs) > 0 {
+		t.Fatal(validationErrs)
+	}
+
+	want := map[string]string{"API_URL": "https://prod.example.com", "QUOTED": "prod-db", "LITERAL": "${ENV}"}
+	for _, app := range config.Infrastructure {
+		for _, setting := range app.Settings {
+			if setting.Value != want[setting.Name] {
+				t.Errorf("%s of %s is %q, want %q", setting.Name, app.Name, setting.Value, want[setting.Name])
+			}
+		}
+		if len(app.Settings) != len(want) {
+			t.Errorf("%s has the settings %v", app.Name, app.Settings)
+		}
+	}
+}
+
+func TestResolveSettingsReportsMissingVariablesOfEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "api.env"), []byte("DB=${MIGR8_TEST_MISSING}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := InfraConfig{Infrastructure: []AppDetails{{Name: "api", SettingsFrom: []SettingsSource{{EnvFile: "api.env"}}}}}
+	validationErrs := ResolveSettings(filepath.Join(dir, "stack.json"), &config, nil)
+	if len(validationErrs) != 1 || !strings.Contains(validationErrs[0].Message, "MIGR8_TEST_MISSING") {
+		t.Fatalf("expected an error about MIGR8_TEST_MISSING, got %v", validationErrs)
+	}
+}
+
+func TestCheckConfigRejectsCopiedKeyVaultReferencesInPipelineMode(t *testing.T) {
+	config := InfraConfig{Infrastructure: []AppDetails{
+		{Name: "api", Type: "function", SettingsFrom: []SettingsSource{{KeyVault: "vault", Secrets: []KeyVaultSecret{{Name: "DB_PASSWORD", Secret: "db-password"}}}}},
+		{Name: "web", Type: "webapp", SettingsMode: SettingsModePipeline, SettingsFrom: []SettingsSource{{App: "api"}}},
+	}}
+	path := filepath.Join(t.TempDir(), "stack.json")
+	if validationErrs := ResolveSettings(path, &config, nil); len(validationErrs) > 0 {
+		t.Fatal(validationErrs)
+	}
+
+	found := false
+	for _, validationErr := range CheckConfig(path, config) {
+		if validationErr.Path == "infrastructure[1].settingsMode" && strings.Contains(validationErr.Message, "DB_PASSWORD") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("the Key Vault reference that web copies from api wasn't rejected")
+	}
+}
+
+func TestReferencedKeyVault(t *testing.T) {
+	cases := map[string]string{
+		"@Microsoft.KeyVault(VaultName=vault;SecretName=db)":                       "vault",
+		"@Microsoft.KeyVault(SecretUri=https://other.vault.azure.net/secrets/db/)": "other",
+		"VaultName=vault": "",
+		"plain":           "",
+	}
+	for value, want := range cases {
+		if vault := referencedKeyVault(value); vault != want {
+			t.Errorf("referencedKeyVault(%q) = %q, want %q", value, vault, want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package migr8
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// stateVersion is bumped on every incompatible change of the state file
+const stateVersion = 1
+
+// stateStore ~ the state of a config and the file it is persisted to. Without a path nothing is persisted
+type stateStore struct {
+	mu    sync.Mutex
+	path  string
+	state *State
+	// notify reports the state files that couldn't be written
+	notify func(event Event)
+}
+
+func newState() *State {
+	return &State{Version: stateVersion, Apps: map[string]*AppState{}}
+}
+
+// StatePath returns where the state of a config lives: next to the config file, with a state file of its own
+// for every environment
+func StatePath(configPath string, env string) string {
+	stateFile := "state.json"
+	if env != "" {
+		stateFile = "state." + env + ".json"
+	}
+	return filepath.Join(filepath.Dir(configPath), ".migr8", stateFile)
+}
+
+// loadState reads the state file at path. A missing file means that the config never ran before
+func loadState(path string) (*stateStore, error) {
+	store := &stateStore{path: path, state: newState(), notify: func(Event) {}}
+	if path == "" {
+		return store, nil
+	}
+
+	content, readErr := os.ReadFile(path)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return store, nil
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	state := newState()
+	unmarshalErr := json.Unmarshal(content, state)
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("%s is corrupted => %w", path, unmarshalErr)
+	}
+	if state.Version > stateVersion {
+		return nil, fmt.Errorf("%s was written by a newer migr8 (state version %d)", path, state.Version)
+	}
+	if state.Apps == nil {
+		state.Apps = map[string]*AppState{}
+	}
+
+	state.Version = stateVersion
+	store.state = state
+	return store, nil
+}
+
+// save writes the state file atomically. The caller must hold mu
+func (store *stateStore) save() error {
+	if store.path == "" {
+		return nil
+	}
+
+	content, marshalErr := json.MarshalIndent(store.state, "", "  ")
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	mkDirErr := os.MkdirAll(filepath.Dir(store.path), 0755)
+	if mkDirErr != nil {
+		return mkDirErr
+	}
+
+	tmpPath := store.path + ".tmp"
+	writeErr := os.WriteFile(tmpPath, content, 0644)
+	if writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmpPath, store.path)
+}
+
+// updateApp applies update to the state of an app and persists the result right away, so that the
+// state survives a crash of the run
+func (store *stateStore) updateApp(appName string, update func(app *AppState)) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	app, ok := store.state.Apps[appName]
+	if !ok {
+		app = &AppState{Resources: []ResourceState{}}
+		store.state.Apps[appName] = app
+	}
+	update(app)
+	app.UpdatedAt = now
+	store.state.UpdatedAt = now
+
+	saveErr := store.save()
+	if saveErr != nil {
+		store.notify(Diagnostic{Level: slog.LevelError, Phase: PhaseState, Resource: "state file", Name: store.path, Message: "failed to write", Err: saveErr})
+	}
+}
+
+// app returns a copy of the state of an app
+func (store *stateStore) app(appName string) (AppState, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	app, ok := store.state.Apps[appName]
+	if !ok {
+		return AppState{}, false
+	}
+	copied := *app
+	copied.Resources = slices.Clone(app.Resources)
+	return copied, true
+}
+
+// recordResource stores whether a run created or reused a resource of an app. A resource that was created
+// by an earlier run stays marked as created
+func (store *stateStore) recordResource(appName string, resource string, name string, isReused bool) {
+	action := "created"
+	if isReused {
+		action = "reused"
+	}
+
+	store.updateApp(appName, func(app *AppState) {
+		for i, existing := range app.Resources {
+			if existing.Resource == resource && existing.Name == name {
+				if existing.Action == "reused" {
+					app.Resources[i].Action = action
+					app.Resources[i].At = time.Now().UTC()
+				}
+				return
+			}
+		}
+		app.Resources = append(app.Resources, ResourceState{Resource: resource, Name: name, Action: action, At: time.Now().UTC()})
+	})
+}
+
+// findResource returns the state of a resource of any app. If several apps share the resource, the app
+// that created it wins over the apps that reused it
+func (store *stateStore) findResource(resource string, name string) (ResourceState, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	found := ResourceState{}
+	isFound := false
+	for _, app := range store.state.Apps {
+		for _, existing := range app.Resources {
+			if existing.Resource == resource && existing.Name == name && (!isFound || existing.Action == "created") {
+				found = existing
+				isFound = true
+			}
+		}
+	}
+	return found, isFound
+}
+
+// forgetResource removes a deleted resource from the state of every app
+func (store *stateStore) forgetResource(resource string, name string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for appName, app := range store.state.Apps {
+		kept := []ResourceState{}
+		for _, existing := range app.Resources {
+			if existing.Resource != resource || existing.Name != name {
+				kept = append(kept, existing)
+			}
+		}
+		app.Resources = kept
+
+		if resource == "pipeline" && app.PipelineName == name {
+			app.PipelineID = 0
+			app.PipelineName = ""
+		}
+		if len(app.Resources) == 0 && app.PipelineID == 0 {
+			delete(store.state.Apps, appName)
+		}
+	}
+	store.state.UpdatedAt = time.Now().UTC()
+
+	saveErr := store.save()
+	if saveErr != nil {
+		store.notify(Diagnostic{Level: slog.LevelError, Phase: PhaseState, Resource: "state file", Name: store.path, Message: "failed to write", Err: saveErr})
+	}
+}
+
+// describeResource summarizes the history of a resource for plan and destroy
+func (store *stateStore) describeResource(resource string, name string) string {
+	existing, ok := store.findResource(resource, name)
+	if !ok {
+		return ""
+	}
+	if existing.Action == "created" {
+		return fmt.Sprintf("created by migr8 on %s", existing.At.Format(time.DateTime))
+	}
+	return "existed before migr8"
+}
@@ -0,0 +1,336 @@
+package migr8
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// InfraConfig ~ the JSON representation of the infrastructure to be created and deployed
+	InfraConfig struct {
+		App            string                 `json:"app"`
+		Pat            string                 `json:"pat"`
+		PatFile        string                 `json:"patFile"`
+		DevOpsOrg      string                 `json:"devopsOrg"`
+		Infrastructure []AppDetails           `json:"infrastructure"`
+		AgentPool      string                 `json:"agentPool"`
+		Environments   map[string]Environment `json:"environments,omitempty"`
+		Retry          *RetryPolicy           `json:"retry,omitempty"`
+	}
+
+	// Environment ~ the overrides of an environment that are deep-merged onto the base config. Apps are matched by name
+	Environment struct {
+		Pat            string       `json:"pat"`
+		PatFile        string       `json:"patFile"`
+		DevOpsOrg      string       `json:"devopsOrg"`
+		Infrastructure []AppDetails `json:"infrastructure"`
+		AgentPool      string       `json:"agentPool"`
+		Retry          *RetryPolicy `json:"retry,omitempty"`
+	}
+
+	// AppDetails ~ the general details of the app to be created
+	AppDetails struct {
+		Type           string            `json:"type"`
+		Name           string            `json:"name"`
+		StorageAccount string            `json:"storageAccount"`
+		ResourceGroup  string            `json:"resourceGroup"`
+		Location       string            `json:"location"`
+		Pipeline       Pipeline          `json:"pipeline"`
+		Settings       []AppSettings     `json:"settings"`
+		SettingsFrom   []SettingsSource  `json:"settingsFrom,omitempty"`
+		SettingsMode   string            `json:"settingsMode,omitempty"`
+		Slots          []Slot            `json:"slots,omitempty"`
+		AppServicePlan string            `json:"appServicePlan"`
+		Runtime        string            `json:"runtime"`
+		Os             string            `json:"os"`
+		Labels         map[string]string `json:"labels,omitempty"`
+		Retry          *RetryPolicy      `json:"retry,omitempty"`
+	}
+
+	// RetryPolicy ~ how failed azure and devops calls are retried. Delays are durations like 2s or 1m. Attempts and
+	// Jitter are pointers, so that an explicit 0 jitter overrides the default
+	RetryPolicy struct {
+		Attempts  *int     `json:"attempts,omitempty"`
+		BaseDelay string   `json:"baseDelay"`
+		MaxDelay  string   `json:"maxDelay"`
+		Jitter    *float64 `json:"jitter,omitempty"`
+	}
+
+	// Pipeline ~ the details of the deployment pipeline
+	Pipeline struct {
+		Name           string `json:"name"`
+		YamlPath       string `json:"yamlPath"`
+		Project        string `json:"project"`
+		Repository     string `json:"repository"`
+		Branch         string `json:"branch"`
+		ServiceAccount string `json:"serviceAccount"`
+	}
+
+	// AppSettings ~ the environment variables for the given webapp or function app
+	AppSettings struct {
+		Name        string `json:"name"`
+		SlotSetting bool   `json:"slotSetting"`
+		Value       string `json:"value"`
+	}
+
+	// SettingsSource ~ where more settings of an app come from: a .env file, another app of the config or the
+	// secrets of a Key Vault. Exactly one of EnvFile, App and KeyVault is set
+	SettingsSource struct {
+		// EnvFile is a file of KEY=VALUE lines. Relative paths are resolved against the config file
+		EnvFile string `json:"envFile,omitempty"`
+		// App copies the settings of another app of the config, including the ones of its own sources
+		App string `json:"app,omitempty"`
+		// KeyVault is the name of the vault that Secrets are referenced from
+		KeyVault string           `json:"keyVault,omitempty"`
+		Secrets  []KeyVaultSecret `json:"secrets,omitempty"`
+		// SlotSetting keeps every setting of the source with its deployment slot when slots are swapped
+		SlotSetting bool `json:"slotSetting,omitempty"`
+	}
+
+	// KeyVaultSecret ~ a setting whose value is a Key Vault reference, which the app resolves at runtime. The
+	// secret itself never ends up in the config
+	KeyVaultSecret struct {
+		Name   string `json:"name"`
+		Secret string `json:"secret"`
+		// Version pins a version of the secret. Without it the app always gets the latest one
+		Version string `json:"version,omitempty"`
+	}
+
+	// Slot ~ a deployment slot of a webapp or function app, e.g. staging. Settings with slotSetting stay with
+	// the slot they were set on when slots are swapped
+	Slot struct {
+		Name string `json:"name"`
+		// Settings override the settings of the app on this slot, or add settings that only the slot has. They
+		// are always slot settings
+		Settings []AppSettings `json:"settings,omitempty"`
+		// Deploy makes the pipeline deploy to this slot, which is swapped into production once it is healthy
+		Deploy bool `json:"deploy"`
+		// HealthCheckPath is requested on the slot before the swap. Defaults to /
+		HealthCheckPath string `json:"healthCheckPath"`
+		// HealthCheckTimeout is how long the slot may take to answer the health check, e.g. 5m. Defaults to 5m
+		HealthCheckTimeout string `json:"healthCheckTimeout"`
+	}
+
+	// SettingsDiff ~ how the live app settings of an app, or of one of its slots, differ from the config
+	SettingsDiff struct {
+		App     string          `json:"app"`
+		Slot    string          `json:"slot,omitempty"`
+		Changes []SettingChange `json:"changes"`
+		// Status is one of in-sync, drifted, synced, skipped or failed
+		Status string `json:"status"`
+		Note   string `json:"note,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	// SettingChange ~ a single setting that differs, with its live value and the value of the config. A setting
+	// whose value matches but that is sticky on one side only is a change too
+	SettingChange struct {
+		Name string `json:"name"`
+		// Action is add, change or remove. It is what a sync does with the live setting
+		Action   string `json:"action"`
+		Live     string `json:"live,omitempty"`
+		Declared string `json:"declared,omitempty"`
+		// LiveSlotSetting and SlotSetting tell if the live and the declared setting stay with the slot on a swap
+		LiveSlotSetting bool `json:"liveSlotSetting,omitempty"`
+		SlotSetting     bool `json:"slotSetting,omitempty"`
+	}
+
+	// InfraPlan ~ the actions that a run would perform, grouped per app
+	InfraPlan struct {
+		Mode string    `json:"mode"`
+		Apps []AppPlan `json:"apps"`
+	}
+
+	// AppPlan ~ the actions that a run would perform for a single app
+	AppPlan struct {
+		App     string       `json:"app"`
+		Type    string       `json:"type"`
+		Actions []PlanAction `json:"actions"`
+	}
+
+	// PlanAction ~ a single action of a plan e.g. create resource group, reuse pipeline, queue run
+	PlanAction struct {
+		Action   string `json:"action"`
+		Resource string `json:"resource"`
+		Name     string `json:"name"`
+		Note     string `json:"note,omitempty"`
+	}
+
+	// State ~ the persisted history of the runs of an infrastructure config
+	State struct {
+		Version   int                  `json:"version"`
+		UpdatedAt time.Time            `json:"updatedAt"`
+		Apps      map[string]*AppState `json:"apps"`
+	}
+
+	// AppState ~ what the runs did for a single app
+	AppState struct {
+		Resources    []ResourceState `json:"resources"`
+		PipelineName string          `json:"pipelineName,omitempty"`
+		PipelineID   int             `json:"pipelineId,omitempty"`
+		RunID        int             `json:"runId,omitempty"`
+		RunURL       string          `json:"runUrl,omitempty"`
+		RunResult    string          `json:"runResult,omitempty"`
+		QueuedAt     *time.Time      `json:"queuedAt,omitempty"`
+		FinishedAt   *time.Time      `json:"finishedAt,omitempty"`
+		UpdatedAt    time.Time       `json:"updatedAt"`
+	}
+
+	// ResourceState ~ a resource of an app and whether migr8 created it or found it already existing
+	ResourceState struct {
+		Resource string    `json:"resource"`
+		Name     string    `json:"name"`
+		Action   string    `json:"action"`
+		At       time.Time `json:"at"`
+	}
+
+	// ValidationError ~ a single problem of an infrastructure config and the json path it was found at
+	ValidationError struct {
+		Path    string
+		Message string
+	}
+
+	// DestroyResult ~ the outcome of deleting a single resource
+	DestroyResult struct {
+		Resource string
+		Name     string
+		Status   string
+		Note     string
+	}
+
+	// AzureResource ~ a resource of a resource group, as az resource list returns it
+	AzureResource struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		// SkuTier is the tier of resources with a sku, e.g. Dynamic for the plan of a consumption function app
+		SkuTier string `json:"skuTier,omitempty"`
+	}
+
+	// PipelineRun ~ a queued run of a deployment pipeline
+	PipelineRun struct {
+		ID     int
+		Status string
+		Result string
+		URL    string
+	}
+
+	// AgentConfig ~ the details of a self hosted agent to be started
+	AgentConfig struct {
+		Name      string
+		DevOpsOrg string
+		Pat       string
+		Pool      string
+	}
+
+	// PhaseResult ~ the outcome of a single phase of a run for a single app
+	PhaseResult struct {
+		App string
+		// Status is one of succeeded, failed, skipped or not-applicable
+		Status string
+		Err    error
+		// Reason tells why the phase skipped the app
+		Reason   string
+		Duration time.Duration
+		// Resources holds the ids of everything the phase created, e.g. azure resource ids, agent container
+		// ids and the devops urls of pipelines and pipeline runs
+		Resources []string
+	}
+
+	// Run ~ the state of a single create, deploy, complete or swap run. It owns the results of every phase
+	Run struct {
+		Mode           string
+		Apps           []AppDetails
+		Agents         []PhaseResult
+		Infrastructure []PhaseResult
+		Pipelines      []PhaseResult
+		Queues         []PhaseResult
+		Swaps          []PhaseResult
+		// Skipped and Resumed are filled by a --resume run before any phase starts
+		Skipped    map[string]string
+		Resumed    map[string]PipelineRun
+		StartedAt  time.Time
+		FinishedAt time.Time
+
+		runner *Runner
+		// stop cancels the run with the failFastError of the first app that failed
+		stop context.CancelCauseFunc
+	}
+
+	// RunReport ~ the outcome of a run per app, for machines and for people who weren't watching the run
+	RunReport struct {
+		Mode            string      `json:"mode"`
+		StartedAt       time.Time   `json:"startedAt"`
+		FinishedAt      time.Time   `json:"finishedAt"`
+		DurationSeconds float64     `json:"durationSeconds"`
+		Succeeded       int         `json:"succeeded"`
+		Failed          int         `json:"failed"`
+		Skipped         int         `json:"skipped"`
+		Apps            []AppReport `json:"apps"`
+	}
+
+	// AppReport ~ the outcome of every phase of a run for a single app. Status is failed if any phase failed,
+	// succeeded if every phase succeeded and skipped otherwise
+	AppReport struct {
+		App             string        `json:"app"`
+		Type            string        `json:"type"`
+		Status          string        `json:"status"`
+		DurationSeconds float64       `json:"durationSeconds"`
+		RunURL          string        `json:"runUrl,omitempty"`
+		Phases          []PhaseReport `json:"phases"`
+	}
+
+	// PhaseReport ~ the outcome of a single phase for a single app
+	PhaseReport struct {
+		Phase           string   `json:"phase"`
+		Status          string   `json:"status"`
+		DurationSeconds float64  `json:"durationSeconds"`
+		Error           string   `json:"error,omitempty"`
+		Reason          string   `json:"reason,omitempty"`
+		Resources       []string `json:"resources,omitempty"`
+	}
+
+	// Runner ~ creates, deploys, plans and destroys the infrastructure of a config. The backends default to
+	// Azure, Azure DevOPS and Docker and can be replaced before any method is called
+	Runner struct {
+		Config      InfraConfig
+		Options     Options
+		Provisioner ResourceProvisioner
+		Pipelines   PipelineService
+		Agents      AgentRuntime
+
+		state     *stateStore
+		observers []Observer
+		// cleanupMu keeps the cleanup of a run and a Cleanup on an interruption from removing the same agents
+		cleanupMu sync.Mutex
+	}
+
+	// Options ~ how a Runner works on a config. The zero value runs every phase without limits or timeouts
+	Options struct {
+		// Parallelism caps the workers of every phase, AgentParallelism, InfraParallelism and QueueParallelism
+		// cap a single phase. 0 means no limit
+		Parallelism      int
+		AgentParallelism int
+		InfraParallelism int
+		QueueParallelism int
+		// InfraTimeout and PipelineTimeout limit the infrastructure of an app and a pipeline run. 0 means no limit
+		InfraTimeout    time.Duration
+		PipelineTimeout time.Duration
+		// PollInterval is how often a queued pipeline run is checked. It defaults to 30s
+		PollInterval time.Duration
+		// Resume reattaches to the pipeline runs recorded in the state and skips the apps whose last run succeeded
+		Resume bool
+		// FailFast stops the run as soon as a phase fails for any app. The apps that are still waiting for a
+		// worker are skipped, running pipeline runs are cancelled and no further phase starts
+		FailFast bool
+		// StatePath is the state file of the config, see StatePath. Without it nothing is persisted
+		StatePath string
+		// SubscriptionID is the azure subscription that pipelines deploy to
+		SubscriptionID string
+		// ConfirmDestroy is asked before Destroy deletes anything. Without it Destroy deletes right away
+		ConfirmDestroy func(pending []DestroyResult) bool
+		// ForceDestroy makes Destroy delete the resources that the state records as reused, i.e. that existed
+		// before migr8 worked on them. They are kept otherwise
+		ForceDestroy bool
+	}
+)
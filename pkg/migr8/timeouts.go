@@ -0,0 +1,75 @@
+package migr8
+
+import (
+	"context"
+	"time"
+)
+
+// defaultPollInterval applies when Options.PollInterval isn't set
+const defaultPollInterval = 30 * time.Second
+
+// awaitCall runs a call that can't be cancelled itself, e.g. a docker client call of a library, and stops waiting
+// for it as soon as ctx is done. The call keeps running in the background until it returns, and then abandoned is
+// called with its error so that whatever it started can be cleaned up
+func awaitCall(ctx context.Context, call func() error, abandoned func(err error)) error {
+	_, err := awaitValue(ctx, func() (struct{}, error) {
+		return struct{}{}, call()
+	}, func(_ struct{}, err error) {
+		abandoned(err)
+	})
+	return err
+}
+
+// awaitValue is awaitCall for calls that return a value
+func awaitValue[K interface{}](ctx context.Context, call func() (K, error), abandoned func(value K, err error)) (K, error) {
+	if err := ctx.Err(); err != nil {
+		var empty K
+		return empty, err
+	}
+
+	type outcome struct {
+		value K
+		err   error
+	}
+	// done is unbuffered, so the outcome is either handed over or passed to abandoned, never both or neither
+	done := make(chan outcome)
+	isAbandoned := make(chan struct{})
+	go func() {
+		value, err := call()
+		select {
+		case done <- outcome{value, err}:
+		case <-isAbandoned:
+			abandoned(value, err)
+		}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		close(isAbandoned)
+		var empty K
+		return empty, ctx.Err()
+	}
+}
+
+// sleepContext waits for the given delay or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withTimeout derives a context that expires after timeout. A timeout of 0 or less never expires
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
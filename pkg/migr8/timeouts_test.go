@@ -0,0 +1,49 @@
+package migr8
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAwaitValueHandsAnAbandonedOutcomeToAbandoned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	abandoned := make(chan string, 1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := awaitValue(ctx, func() (string, error) {
+		<-release
+		return "agent-1", nil
+	}, func(value string, err error) {
+		abandoned <- value
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	close(release)
+	select {
+	case value := <-abandoned:
+		if value != "agent-1" {
+			t.Fatalf("expected the abandoned value agent-1, got %q", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("abandoned was never called")
+	}
+}
+
+func TestAwaitValueReturnsTheOutcomeOfACallThatFinishes(t *testing.T) {
+	value, err := awaitValue(context.Background(), func() (int, error) {
+		return 42, nil
+	}, func(int, error) {
+		t.Error("abandoned was called for a call that finished")
+	})
+	if err != nil || value != 42 {
+		t.Fatalf("expected 42, got %d, %v", value, err)
+	}
+}
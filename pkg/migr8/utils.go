@@ -0,0 +1,121 @@
+package migr8
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ReadConfig reads a json, yaml or toml file, picked by its extension, and deserializes it into K
+func ReadConfig[K interface{}](path string, model K) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ReadJSON(path, model)
+	case ".yaml", ".yml":
+		return ReadYAML(path, model)
+	case ".toml":
+		return ReadTOML(path, model)
+	}
+
+	return fmt.Errorf("%s: unsupported config format. Use a .json, .yaml, .yml or .toml file", path)
+}
+
+// ReadJSON reads a json file and deserializes it into K
+func ReadJSON[K interface{}](path string, model K) error {
+	config, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return readErr
+	}
+
+	configErr := json.Unmarshal(config, &model)
+
+	if configErr != nil {
+		return jsonPositionError(path, config, configErr)
+	}
+	return nil
+}
+
+// ReadYAML reads a yaml file and deserializes it into K. Fields are matched by their json tags
+func ReadYAML[K interface{}](path string, model K) error {
+	config, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return readErr
+	}
+
+	configErr := yaml.Unmarshal(config, model)
+
+	if configErr != nil {
+		return yamlPositionError(path, configErr)
+	}
+	return nil
+}
+
+// ReadTOML reads a toml file and deserializes it into K. Keys are matched case insensitively to the field names
+func ReadTOML[K interface{}](path string, model K) error {
+	config, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return readErr
+	}
+
+	configErr := toml.Unmarshal(config, model)
+
+	if configErr != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(configErr, &decodeErr) {
+			line, column := decodeErr.Position()
+			configErr = fmt.Errorf("%s:%d:%d: %s", path, line, column, decodeErr.Error())
+		}
+		return configErr
+	}
+	return nil
+}
+
+// jsonPositionError prefixes a json decode error with the line and column of the offset it reports
+func jsonPositionError(path string, content []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	line, column := 1, 1
+	for _, char := range content[:min(int(offset), len(content))] {
+		if char == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	// the offset points right after the character that failed
+	column = max(column-1, 1)
+
+	return fmt.Errorf("%s:%d:%d: %w", path, line, column, err)
+}
+
+// yamlErrorPosition matches the [line:column] prefix of the yaml decode errors
+var yamlErrorPosition = regexp.MustCompile(`^\[(\d+):(\d+)\]\s*`)
+
+// yamlPositionError rewrites the [line:column] prefix of a yaml decode error in the same format as json and toml
+func yamlPositionError(path string, err error) error {
+	message := yaml.FormatError(err, false, false)
+	position := yamlErrorPosition.FindStringSubmatch(message)
+	if position == nil {
+		return fmt.Errorf("%s: %s", path, message)
+	}
+	return fmt.Errorf("%s:%s:%s: %s", path, position[1], position[2], strings.TrimSpace(message[len(position[0]):]))
+}
@@ -0,0 +1,308 @@
+package migr8
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StorageAccountPattern is the naming rule of azure storage accounts
+const StorageAccountPattern = `^[a-z0-9]{3,24}$`
+
+var (
+	// AppTypes are the types of apps that migr8 can create
+	AppTypes = []string{"function", "webapp"}
+
+	storageAccountName = regexp.MustCompile(StorageAccountPattern)
+	slotName           = regexp.MustCompile(SlotNamePattern)
+)
+
+// CheckConfig returns every mistake of a config that was read from path. The file is read once more to find
+// the keys that don't match any property, because decoding silently drops them
+func CheckConfig(path string, config InfraConfig) []ValidationError {
+	validationErrs := []ValidationError{}
+
+	var raw map[string]interface{}
+	if ReadConfig(path, &raw) == nil {
+		validationErrs = append(validationErrs, unknownKeys("", raw, reflect.TypeOf(config))...)
+	}
+
+	// a missing token is only an error when a command needs it, since it may also come from the environment or the keyring
+	if config.Pat == "env:" {
+		validationErrs = append(validationErrs, ValidationError{"pat", "env: needs the name of an environment variable, e.g. env:AZP_TOKEN"})
+	}
+	if config.Pat != "" && config.PatFile != "" {
+		validationErrs = append(validationErrs, ValidationError{"patFile", "set either pat or patFile"})
+	}
+	if strings.TrimSpace(config.DevOpsOrg) == "" {
+		validationErrs = append(validationErrs, ValidationError{"devopsOrg", "the azure devops organization url is required"})
+	}
+	if devopsURL, err := url.Parse(config.DevOpsOrg); config.DevOpsOrg != "" && (err != nil || devopsURL.Scheme != "https" || devopsURL.Host == "") {
+		validationErrs = append(validationErrs, ValidationError{"devopsOrg", fmt.Sprintf("%q is not an https url, e.g. https://dev.azure.com/<organization-name>", config.DevOpsOrg)})
+	}
+	if len(config.Infrastructure) == 0 {
+		validationErrs = append(validationErrs, ValidationError{"infrastructure", "at least one app is required"})
+	}
+
+	validationErrs = append(validationErrs, checkRetryPolicy("retry", config.Retry)...)
+
+	names := map[string]string{}
+	for i, app := range config.Infrastructure {
+		validationErrs = append(validationErrs, checkApp(fmt.Sprintf("infrastructure[%d]", i), app, names)...)
+	}
+	// an app may copy the settings of any app of the config, so the sources are checked once every name is known
+	for i, app := range config.Infrastructure {
+		validationErrs = append(validationErrs, checkSettingsSources(fmt.Sprintf("infrastructure[%d]", i), app, names)...)
+	}
+
+	return validationErrs
+}
+
+// checkApp returns every mistake of a single app. names maps the app names seen so far to their path
+func checkApp(path string, app AppDetails, names map[string]string) []ValidationError {
+	validationErrs := []ValidationError{}
+	required := func(property string, value string, reason string) {
+		if strings.TrimSpace(value) == "" {
+			validationErrs = append(validationErrs, ValidationError{path + "." + property, "is required" + reason})
+		}
+	}
+
+	required("name", app.Name, "")
+	if previous, isDuplicate := names[app.Name]; app.Name != "" && isDuplicate {
+		validationErrs = append(validationErrs, ValidationError{path + ".name", fmt.Sprintf("duplicate app name %q, already used by %s", app.Name, previous)})
+	}
+	if _, isDuplicate := names[app.Name]; !isDuplicate {
+		names[app.Name] = path
+	}
+
+	required("type", app.Type, "")
+	if app.Type != "" && !slices.Contains(AppTypes, app.Type) {
+		validationErrs = append(validationErrs, ValidationError{path + ".type", fmt.Sprintf("unknown type %q. Use %s", app.Type, strings.Join(AppTypes, " | "))})
+	}
+	required("resourceGroup", app.ResourceGroup, "")
+
+	if app.Type == "function" {
+		required("storageAccount", app.StorageAccount, " for a function app")
+		if app.StorageAccount != "" && !storageAccountName.MatchString(app.StorageAccount) {
+			validationErrs = append(validationErrs, ValidationError{path + ".storageAccount", fmt.Sprintf("%q must be 3 to 24 lowercase letters and numbers", app.StorageAccount)})
+		}
+	}
+	if app.Type == "webapp" {
+		required("appServicePlan", app.AppServicePlan, " for a webapp")
+	}
+
+	validationErrs = append(validationErrs, checkRetryPolicy(path+".retry", app.Retry)...)
+
+	settings := map[string]bool{}
+	for i, setting := range app.Settings {
+		settingPath := fmt.Sprintf("%s.settings[%d].name", path, i)
+		if strings.TrimSpace(setting.Name) == "" {
+			validationErrs = append(validationErrs, ValidationError{settingPath, "is required"})
+		}
+		if settings[setting.Name] {
+			validationErrs = append(validationErrs, ValidationError{settingPath, fmt.Sprintf("duplicate setting %q", setting.Name)})
+		}
+		settings[setting.Name] = true
+	}
+
+	if app.SettingsMode != "" && !slices.Contains(SettingsModes, app.SettingsMode) {
+		validationErrs = append(validationErrs, ValidationError{path + ".settingsMode", fmt.Sprintf("unknown settings mode %q. Use %s", app.SettingsMode, strings.Join(SettingsModes, " | "))})
+	}
+	if app.SettingsMode == SettingsModePipeline && app.Type != "webapp" {
+		validationErrs = append(validationErrs, ValidationError{path + ".settingsMode", "only webapps can pass their settings as pipeline parameters"})
+	}
+
+	// the references can come from the app's own vaults, from the apps it copies or be written inline
+	if app.SettingsAsParameters() {
+		references := []string{}
+		for _, setting := range app.Settings {
+			if referencedKeyVault(setting.Value) != "" {
+				references = append(references, setting.Name)
+			}
+		}
+		if len(references) > 0 {
+			validationErrs = append(validationErrs, ValidationError{path + ".settingsMode", fmt.Sprintf("%s are Key Vault references, which only resolve as app settings. Use settingsMode app", strings.Join(references, ", "))})
+		}
+	}
+
+	validationErrs = append(validationErrs, checkSlots(path, app)...)
+
+	return validationErrs
+}
+
+// checkSettingsSources returns every mistake of the settingsFrom sources of an app. names maps every app name of
+// the config to its path
+func checkSettingsSources(path string, app AppDetails, names map[string]string) []ValidationError {
+	validationErrs := []ValidationError{}
+
+	for i, source := range app.SettingsFrom {
+		sourcePath := fmt.Sprintf("%s.settingsFrom[%d]", path, i)
+
+		kinds := 0
+		for _, value := range []string{source.EnvFile, source.App, source.KeyVault} {
+			if value != "" {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			validationErrs = append(validationErrs, ValidationError{sourcePath, "set exactly one of envFile, app or keyVault"})
+		}
+
+		if source.App != "" {
+			if _, isFound := names[source.App]; !isFound {
+				validationErrs = append(validationErrs, ValidationError{sourcePath + ".app", fmt.Sprintf("unknown app %q", source.App)})
+			}
+			if source.App == app.Name {
+				validationErrs = append(validationErrs, ValidationError{sourcePath + ".app", "an app can't copy its own settings"})
+			}
+		}
+
+		if len(source.Secrets) > 0 && source.KeyVault == "" {
+			validationErrs = append(validationErrs, ValidationError{sourcePath + ".keyVault", "is required for secrets"})
+		}
+		if source.KeyVault == "" {
+			continue
+		}
+		if !keyVaultName.MatchString(source.KeyVault) {
+			validationErrs = append(validationErrs, ValidationError{sourcePath + ".keyVault", fmt.Sprintf("%q must be 3 to 24 letters, numbers and hyphens, starting with a letter", source.KeyVault)})
+		}
+		if len(source.Secrets) == 0 {
+			validationErrs = append(validationErrs, ValidationError{sourcePath + ".secrets", "at least one secret is required"})
+		}
+		for j, secret := range source.Secrets {
+			if !keyVaultSecret.MatchString(secret.Secret) {
+				validationErrs = append(validationErrs, ValidationError{fmt.Sprintf("%s.secrets[%d].secret", sourcePath, j), fmt.Sprintf("%q must be 1 to 127 letters, numbers and hyphens", secret.Secret)})
+			}
+		}
+	}
+
+	return validationErrs
+}
+
+// checkSlots returns every mistake of the deployment slots of an app. Only a single slot can be deployed to
+func checkSlots(path string, app AppDetails) []ValidationError {
+	validationErrs := []ValidationError{}
+
+	names := map[string]bool{}
+	deploySlot := ""
+	for i, slot := range app.Slots {
+		slotPath := fmt.Sprintf("%s.slots[%d]", path, i)
+		switch {
+		case strings.TrimSpace(slot.Name) == "":
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".name", "is required"})
+		case strings.EqualFold(slot.Name, "production"):
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".name", "production is the app itself. Name the slot e.g. staging"})
+		case !slotName.MatchString(slot.Name):
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".name", fmt.Sprintf("%q must be letters, numbers and hyphens", slot.Name)})
+		case names[strings.ToLower(slot.Name)]:
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".name", fmt.Sprintf("duplicate slot %q", slot.Name)})
+		}
+		names[strings.ToLower(slot.Name)] = true
+
+		if slot.Deploy && deploySlot != "" {
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".deploy", fmt.Sprintf("only one slot can be deployed to, %s already is", deploySlot)})
+		}
+		if slot.Deploy && deploySlot == "" {
+			deploySlot = slot.Name
+		}
+
+		if slot.HealthCheckPath != "" && !strings.HasPrefix(slot.HealthCheckPath, "/") {
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".healthCheckPath", fmt.Sprintf("%q must start with /, e.g. /health", slot.HealthCheckPath)})
+		}
+		if timeout, err := time.ParseDuration(slot.HealthCheckTimeout); slot.HealthCheckTimeout != "" && (err != nil || timeout <= 0) {
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".healthCheckTimeout", fmt.Sprintf("%q is not a positive duration, e.g. 5m or 90s", slot.HealthCheckTimeout)})
+		}
+
+		if len(slot.Settings) > 0 && app.SettingsAsParameters() {
+			validationErrs = append(validationErrs, ValidationError{slotPath + ".settings", "the settings of the app are passed to the pipeline. Slot settings need settingsMode app"})
+		}
+		settings := map[string]bool{}
+		for j, setting := range slot.Settings {
+			settingPath := fmt.Sprintf("%s.settings[%d].name", slotPath, j)
+			if strings.TrimSpace(setting.Name) == "" {
+				validationErrs = append(validationErrs, ValidationError{settingPath, "is required"})
+			}
+			if settings[setting.Name] {
+				validationErrs = append(validationErrs, ValidationError{settingPath, fmt.Sprintf("duplicate setting %q", setting.Name)})
+			}
+			settings[setting.Name] = true
+		}
+	}
+
+	return validationErrs
+}
+
+// unknownKeys walks a decoded config along the type it is decoded into and returns every key that doesn't
+// match the json tag of a field
+func unknownKeys(path string, value interface{}, model reflect.Type) []ValidationError {
+	validationErrs := []ValidationError{}
+
+	switch model.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return validationErrs
+		}
+
+		fields := map[string]reflect.Type{}
+		for i := 0; i < model.NumField(); i++ {
+			name := strings.Split(model.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = model.Field(i).Type
+			}
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			keyPath := strings.TrimPrefix(path+"."+key, ".")
+			field, isKnown := fields[key]
+			// json configs may point their editor to the schema
+			if keyPath == "$schema" {
+				continue
+			}
+			if !isKnown {
+				validationErrs = append(validationErrs, ValidationError{keyPath, "unknown key"})
+				continue
+			}
+			validationErrs = append(validationErrs, unknownKeys(keyPath, object[key], field)...)
+		}
+
+	case reflect.Pointer:
+		return unknownKeys(path, value, model.Elem())
+
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return validationErrs
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			validationErrs = append(validationErrs, unknownKeys(strings.TrimPrefix(path+"."+key, "."), object[key], model.Elem())...)
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return validationErrs
+		}
+		for i, item := range items {
+			validationErrs = append(validationErrs, unknownKeys(fmt.Sprintf("%s[%d]", path, i), item, model.Elem())...)
+		}
+	}
+
+	return validationErrs
+}